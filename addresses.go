@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	// utility
+	"./utils"
+)
+
+// deposit addresses withdrawals are allowed to go to
+// built from <EXCHANGE>_<ASSET>_ADDRESS props
+// ex: ["binance"]["ETH"] = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+var address_book = make(map[string]map[string]string)
+
+// reads deposit addresses into the address book
+// ETH style addresses have to carry a valid EIP-55 checksum
+// and when ADDRESS_BOOK_HASH is set, the whole book has to match it
+// anything that doesn't check out is left out and flagged
+func load_address_book() {
+
+	var lines []string
+
+	for key, value := range props {
+
+		if !strings.HasSuffix(key, "_ADDRESS") || value == "" {
+			continue
+		}
+
+		split := strings.Split(key, "_")
+
+		if len(split) != 3 {
+			continue
+		}
+
+		exchange := strings.ToLower(split[0])
+		asset := split[1]
+
+		if (asset == "ETH" || strings.HasPrefix(value, "0x")) && !utils.Valid_eth_address(value) {
+			throw_flag(utils.Warning, "exchange", exchange, "Address "+key+" fails its EIP-55 checksum, left out of the address book.")
+			continue
+		}
+
+		if address_book[exchange] == nil {
+			address_book[exchange] = make(map[string]string)
+		}
+
+		address_book[exchange][asset] = value
+		lines = append(lines, key+"="+value)
+
+	}
+
+	// cold wallet profit is swept to, see sweep()
+	if props["TREZOR_ETH"] != "" {
+
+		if utils.Valid_eth_address(props["TREZOR_ETH"]) {
+			address_book["trezor"] = map[string]string{"ETH": props["TREZOR_ETH"]}
+			lines = append(lines, "TREZOR_ETH="+props["TREZOR_ETH"])
+		} else {
+			throw_flag(utils.Warning, "global", "", "Address TREZOR_ETH fails its EIP-55 checksum, left out of the address book.")
+		}
+
+	}
+
+	if props["ADDRESS_BOOK_HASH"] == "" {
+		return
+	}
+
+	// sha256 of the sorted KEY=address lines, one per line
+	sort.Strings(lines)
+	hash := sha256.Sum256([]byte(strings.Join(lines, "\n") + "\n"))
+	book_hash := hex.EncodeToString(hash[:])
+
+	if book_hash != strings.ToLower(props["ADDRESS_BOOK_HASH"]) {
+		throw_flag(utils.Halt, "global", "", "Address book hash "+book_hash+" doesn't match ADDRESS_BOOK_HASH, no withdrawals allowed.")
+		address_book = make(map[string]map[string]string)
+	}
+
+}
+
+// where to send an asset on an exchange, ERC20 tokens
+// without an address of their own share the ETH one
+func deposit_address(exchange, asset string) string {
+
+	if address := address_book[exchange][asset]; address != "" {
+		return address
+	}
+
+	if !quotes[asset] {
+		return address_book[exchange]["ETH"]
+	}
+
+	return ""
+
+}
+
+// whether the address is one we deposit the asset to somewhere
+func whitelisted(asset, destination string) bool {
+
+	if destination == "" {
+		return false
+	}
+
+	for exchange := range address_book {
+		if deposit_address(exchange, asset) == destination {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// every withdrawal goes through here, transfers to
+// addresses missing from the address book are refused
+func withdraw(from, asset, destination string, amount float64) (string, bool) {
+
+	exchange, ok := get_exchange(from)
+
+	if !ok {
+		return "", false
+	}
+
+	if !whitelisted(asset, destination) {
+
+		message := fmt.Sprintf("Refused withdrawal of %f %s from %s to %q, address is not in the address book.", amount, asset, from, destination)
+		throw_flag(utils.Halt, "global", "", message)
+
+		return "", false
+
+	}
+
+	if !allow_withdrawal(from, asset, amount) {
+		return "", false
+	}
+
+	return exchange.Start_transfer(asset, destination, amount)
+
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// simulated exchange for paper trading
+	"./exchanges/paper"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// set while a backtest replays the prices collection
+// keeps discord quiet and flags out of the live database
+var backtesting bool
+var backtest_flagged bool
+
+type Backtest_report struct {
+	Trades          int
+	Open            int
+	Gross_profit    map[string]float64
+	Net_profit      float64
+	Max_drawdown    float64
+	Transfers       int
+	Time_in_transit time.Duration
+}
+
+// replays stored prices through the same comparison and
+// transaction steps as run(), with paper exchanges doing the fills
+// ex: ./arbitrage backtest -from "2018-03-01 00:00" -threshold 5 -tokens NULS:100
+func backtest(args []string) {
+
+	options := flag.NewFlagSet("backtest", flag.ExitOnError)
+	from := options.String("from", "", "start of replay, YYYY-MM-DD HH:MM")
+	to := options.String("to", "", "end of replay, YYYY-MM-DD HH:MM, defaults to now")
+	threshold := options.Float64("threshold", percent_threshold, "overrides PERCENT_THRESHOLD")
+	quantities := options.String("tokens", "", "overrides TOKENS, ex: NULS:100,LINK:50")
+	options.Parse(args)
+
+	from_date, err := time.Parse("2006-01-02 15:04", *from)
+	if err != nil {
+		fmt.Println("backtest requires -from in YYYY-MM-DD HH:MM format")
+		return
+	}
+
+	to_date := time.Now()
+
+	if *to != "" {
+		to_date, err = time.Parse("2006-01-02 15:04", *to)
+		utils.Check(err)
+	}
+
+	if *quantities != "" {
+		tokens = make(map[string]bool)
+		trade_quantity = make(map[string]int)
+		parse_tokens(*quantities)
+	}
+
+	percent_threshold = *threshold
+
+	//-----------------------------------//
+	// swap every exchange for a paper one
+	// quoting the streamed prices
+	//-----------------------------------//
+	backtesting = true
+
+	if !paper_trading {
+		initialize_paper_trading()
+		paper_trading = true
+	}
+
+	paper_recorded = true
+	mongo.Use_backtest_transactions()
+
+	for _, name := range exchanges.Names() {
+		exchanges.Register(name, paper.Adapter{Name: name, Quoter: paper.Streamed{Exchange: name}})
+	}
+
+	var report = Backtest_report{Gross_profit: make(map[string]float64)}
+	var start_value, peak float64
+	var first = true
+
+	// transactions currently waiting on a transfer
+	// and the recorded time they were first seen doing so
+	transit := make(map[string]time.Time)
+
+	mongo.Stream_prices(from_date, to_date, func(at time.Time, snapshot map[string]map[string]float64) bool {
+
+		paper.Set_prices(at, snapshot)
+
+		for _, name := range exchanges.Names() {
+			exchange, _ := exchanges.Get(name)
+			exchange_prices[name] = exchange.Get_price(tokens, quotes)
+			exchange_balances[name] = exchange.Get_balances(with_quotes(tokens))
+		}
+
+		exchange_prices = validate_prices(exchange_prices)
+
+		get_order_books(exchange_prices)
+
+		compare_prices(exchange_prices, exclude_tokens(exchange_balances))
+
+		incomplete := mongo.Get_incomplete_transactions()
+		track_transit(&report, transit, incomplete, at)
+		resume_transactions(incomplete)
+
+		// portfolio value over time gives net profit and drawdown
+		value := portfolio_value(paper.Balances(), exchange_prices)
+
+		if first {
+			start_value = value
+			peak = value
+			first = false
+		}
+
+		if value > peak {
+			peak = value
+		}
+
+		if peak-value > report.Max_drawdown {
+			report.Max_drawdown = peak - value
+		}
+
+		report.Net_profit = value - start_value
+
+		return !backtest_flagged
+
+	})
+
+	for _, t := range mongo.Get_completed_transactions() {
+
+		// quote received for the tokens, minus what buying
+		// the same amount back cost, before transfer fees
+		report.Trades++
+		report.Gross_profit[utils.Pair_quote(transaction_pair(t))] += t.Sell_cost - t.Sell_quantity*t.Buy_price
+
+	}
+
+	report.Open = len(mongo.Get_incomplete_transactions())
+
+	print_backtest_report(report, backtest_flagged)
+
+}
+
+func track_transit(report *Backtest_report, transit map[string]time.Time, transactions []utils.Transaction, at time.Time) {
+
+	in_transit := make(map[string]bool)
+
+	for _, t := range transactions {
+
+		if t.Status != utils.TransferStarted {
+			continue
+		}
+
+		id := t.ID.Hex()
+		in_transit[id] = true
+
+		if _, ok := transit[id]; !ok {
+			transit[id] = at
+		}
+
+	}
+
+	// anything no longer waiting has landed
+	for id, started := range transit {
+		if !in_transit[id] {
+			report.Transfers++
+			report.Time_in_transit += at.Sub(started)
+			delete(transit, id)
+		}
+	}
+
+}
+
+// ETH value of all holdings, tokens are valued at the price
+// on the exchange holding them, or any other if it has none
+// assets without an ETH market are left out
+func portfolio_value(balances map[string]map[string]float64, exchange_prices map[string]map[string]float64) float64 {
+
+	value := 0.0
+
+	for exchange, holdings := range balances {
+
+		for token, amount := range holdings {
+
+			if token == "ETH" {
+				value += amount
+				continue
+			}
+
+			price := exchange_prices[exchange][utils.Pair(token, "ETH")]
+
+			if price == 0 {
+				price = any_price(token, exchange_prices)
+			}
+
+			value += amount * price
+
+		}
+
+	}
+
+	return value
+
+}
+
+// first price found for the token on any exchange
+func any_price(token string, exchange_prices map[string]map[string]float64) float64 {
+
+	for _, price := range filter_prices(utils.Pair(token, "ETH"), exchange_prices) {
+		return price
+	}
+
+	return 0
+
+}
+
+func print_backtest_report(report Backtest_report, flagged bool) {
+
+	average := time.Duration(0)
+
+	if report.Transfers > 0 {
+		average = report.Time_in_transit / time.Duration(report.Transfers)
+	}
+
+	fmt.Println("------------------------start")
+	fmt.Println("BACKTEST SUMMARY")
+	fmt.Println("-----------------------------")
+	fmt.Printf("threshold:        %.2f%%\n", percent_threshold)
+	fmt.Printf("trades:           %d completed, %d open\n", report.Trades, report.Open)
+
+	for quote, profit := range report.Gross_profit {
+		fmt.Printf("gross profit:     %.6f %s\n", profit, quote)
+	}
+
+	fmt.Printf("net profit:       %.6f ETH\n", report.Net_profit)
+	fmt.Printf("max drawdown:     %.6f ETH\n", report.Max_drawdown)
+	fmt.Printf("time in transit:  %s total, %s average over %d transfers\n", report.Time_in_transit, average, report.Transfers)
+
+	if flagged {
+		fmt.Println("stopped early, a flag was thrown")
+	}
+
+	fmt.Println("--------------------------end")
+
+}
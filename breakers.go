@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// discord bot
+	"./discord"
+
+	// utility
+	"./utils"
+)
+
+// exchanges whose api misbehaves are left out of comparisons
+// and order routing until they've been healthy for a cooldown
+// prices are still collected from them, to tell when they recover
+type breaker struct {
+	open   bool
+	until  time.Time
+	reason string
+	prices int
+}
+
+var breakers = make(map[string]*breaker)
+
+// trips the breakers of exchanges that misbehaved since the last run
+// BREAKER_ERRORS consecutive failed calls, a call slower than
+// BREAKER_LATENCY seconds, or fewer than BREAKER_MIN_PRICES percent
+// of the prices it returned last time it was healthy
+// tripped exchanges stay out for BREAKER_COOLDOWN minutes
+// restarting every time they misbehave again
+func check_breakers(exchange_prices map[string]map[string]float64) {
+
+	cooldown := time.Duration(prop_float("BREAKER_COOLDOWN", 15)) * time.Minute
+
+	for _, name := range exchanges.Names() {
+
+		if breakers[name] == nil {
+			breakers[name] = &breaker{}
+		}
+
+		b := breakers[name]
+		reason := breaker_fault(b, utils.Take_api_health(name), len(exchange_prices[name]))
+
+		if reason != "" {
+
+			if !b.open {
+				breaker_alert("Circuit breaker for " + name + " opened, " + reason + ".")
+			}
+
+			b.open = true
+			b.until = time.Now().Add(cooldown)
+			b.reason = reason
+
+			continue
+
+		}
+
+		if b.open && time.Now().After(b.until) {
+			b.open = false
+			breaker_alert("Circuit breaker for " + name + " closed, healthy since " + b.until.Add(-cooldown).Format("15:04") + ".")
+		}
+
+		if !b.open {
+			b.prices = len(exchange_prices[name])
+		}
+
+	}
+
+}
+
+// what's wrong with an exchange's api, empty when nothing is
+func breaker_fault(b *breaker, health utils.Api_health, prices int) string {
+
+	if limit := prop_float("BREAKER_ERRORS", 5); health.Consecutive >= int(limit) {
+		return fmt.Sprintf("%d consecutive api errors, last %s", health.Consecutive, health.Last_error)
+	}
+
+	if limit := prop_float("BREAKER_LATENCY", 10); health.Slowest > time.Duration(limit*float64(time.Second)) {
+		return fmt.Sprintf("api call took %.1f seconds", health.Slowest.Seconds())
+	}
+
+	if prices == 0 {
+		return "no prices returned"
+	}
+
+	if limit := prop_float("BREAKER_MIN_PRICES", 50); float64(prices*100) < float64(b.prices)*limit {
+		return fmt.Sprintf("%d of %d prices returned", prices, b.prices)
+	}
+
+	return ""
+
+}
+
+func tripped(name string) bool {
+
+	b, ok := breakers[name]
+
+	return ok && b.open
+
+}
+
+// prices of exchanges whose breakers are closed
+func live_prices(exchange_prices map[string]map[string]float64) map[string]map[string]float64 {
+
+	live := make(map[string]map[string]float64)
+
+	for name, prices := range exchange_prices {
+		if !tripped(name) {
+			live[name] = prices
+		}
+	}
+
+	return live
+
+}
+
+func breaker_alert(message string) {
+
+	mongo.Log(message)
+
+	if !backtesting {
+		discord.Send_alert(message)
+	}
+
+}
@@ -15,6 +15,13 @@ import (
 var mgoSession *mgo.Session
 var mgoDatabase string
 
+// transactions started in paper trading mode are flagged
+// so that live and paper runs never resume each other's work
+var paper_trading bool
+
+// backtests keep their transactions away from the real ones
+var transactions_collection = "transactions"
+
 type Price struct {
 	ID        bson.ObjectId `bson:"_id,omitempty"`
 	Token     string
@@ -42,19 +49,54 @@ func Initialize(host string, database string, username string, password string)
 
 }
 
-func Place_sell_order(token, exchange, transaction_id string, price float64) {
+func Set_paper_trading(on bool) {
+
+	paper_trading = on
+
+}
+
+// matches rows of the current mode, rows saved before
+// paper trading existed have no flag and belong to live runs
+func paper_filter() interface{} {
+
+	if paper_trading {
+		return true
+	}
+
+	return bson.M{"$ne": true}
+
+}
+
+// switches transactions to a scratch collection
+// emptied at the start of every backtest
+func Use_backtest_transactions() {
+
+	transactions_collection = "backtest_transactions"
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C(transactions_collection)
+	collection.RemoveAll(nil)
+
+}
+
+func Place_sell_order(pair, via, exchange, transaction_id string, price float64) {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
 	row := utils.Transaction{
 		Status:        utils.SellPlaced,
-		Token:         token,
+		Token:         utils.Pair_token(pair),
+		Quote:         utils.Pair_quote(pair),
+		Sell_via:      via,
 		Sell_price:    price,
 		Sell_exchange: exchange,
 		Sell_tx_id:    transaction_id,
+		Paper:         paper_trading,
 		Timestamp:     time.Now(),
 	}
 
@@ -64,100 +106,254 @@ func Place_sell_order(token, exchange, transaction_id string, price float64) {
 
 }
 
-func Sell_order_completed(row_id, sell_exchange string, amount float64) {
+// both legs of an inventory trade are placed together
+// and recorded in a single transaction
+func Place_inventory_orders(pair, sell_exchange, sell_tx_id, buy_exchange, buy_tx_id string, sell_price, buy_price, quantity float64) {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
-	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
-	change := bson.M{"$set": bson.M{"status": utils.SellCompleted, "sell_cost": amount}}
+	row := utils.Transaction{
+		Status:        utils.SellPlaced,
+		Strategy:      "inventory",
+		Token:         utils.Pair_token(pair),
+		Quote:         utils.Pair_quote(pair),
+		Sell_price:    sell_price,
+		Sell_quantity: quantity,
+		Sell_exchange: sell_exchange,
+		Sell_tx_id:    sell_tx_id,
+		Buy_price:     buy_price,
+		Buy_quantity:  quantity,
+		Buy_exchange:  buy_exchange,
+		Buy_tx_id:     buy_tx_id,
+		Paper:         paper_trading,
+		Timestamp:     time.Now(),
+	}
+
+	if err := collection.Insert(row); err != nil {
+		panic(err)
+	}
+
+}
+
+// moves a transaction from one status to another
+// the update only matches while it is still in from, so a step
+// that raced with another, or was replayed, changes nothing
+// every move is added to the transaction's history
+func transition(row_id string, from, to utils.Status, reason string, fields bson.M) bool {
+
+	if !utils.Transaction_states.Can_transition(from, to) {
+		Log(fmt.Sprintf("Illegal transition of %s from %d to %d, skipping.", row_id, from, to))
+		return false
+	}
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C(transactions_collection)
+
+	if fields == nil {
+		fields = bson.M{}
+	}
+
+	fields["status"] = to
+
+	history := utils.Transition{From: from, To: to, Reason: reason, Timestamp: time.Now()}
+
+	query := bson.M{"_id": bson.ObjectIdHex(row_id), "status": from}
+	change := bson.M{"$set": fields, "$push": bson.M{"history": history}}
 	err := collection.Update(query, change)
+
+	if err == mgo.ErrNotFound {
+		Log(fmt.Sprintf("Transaction %s is no longer at status %d, skipping.", row_id, from))
+		return false
+	}
+
 	utils.Check(err)
 
+	return true
+
+}
+
+// partially filled orders complete with what executed
+// and the rest of the trade is based on those amounts
+func Sell_order_completed(row_id string, order utils.Order_status) {
+
+	fields := bson.M{"sell_cost": order.Cost() - order.Fee, "sell_quantity": order.Quantity, "sell_price": order.Price}
+	transition(row_id, utils.SellPlaced, utils.SellCompleted, fmt.Sprintf("sell order filled %f at %f", order.Quantity, order.Price), fields)
+
 }
 
-func Transfer_started(row_id, tx_id, buy_exchange string, buy_price float64) {
+// synthetic sells are converted to the quote after filling
+// status stays the same, only the amount changes
+func Sell_cost_converted(row_id string, amount float64) {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
-	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
-	change := bson.M{"$set": bson.M{"status": utils.TransferStarted, "buy_exchange": buy_exchange}}
+	query := bson.M{"_id": bson.ObjectIdHex(row_id), "status": utils.SellCompleted}
+	change := bson.M{"$set": bson.M{"sell_cost": amount}}
 	err := collection.Update(query, change)
-	utils.Check(err)
+
+	if err != mgo.ErrNotFound {
+		utils.Check(err)
+	}
+
+}
+
+func Transfer_started(row_id, tx_id, buy_exchange, buy_via string, buy_price float64) {
+
+	transition(row_id, utils.SellCompleted, utils.TransferStarted, "transfer started", bson.M{"transfer_id": tx_id, "buy_exchange": buy_exchange, "buy_via": buy_via})
 
 }
 
-func Transfer_completed(row_id string) {
+// chain txid of the withdrawal, used to find the deposit
+func Transfer_txid_resolved(row_id, txid string) {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
-	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
-	change := bson.M{"$set": bson.M{"status": utils.TransferCompleted}}
+	query := bson.M{"_id": bson.ObjectIdHex(row_id), "status": utils.TransferStarted}
+	change := bson.M{"$set": bson.M{"transfer_txid": txid}}
 	err := collection.Update(query, change)
-	utils.Check(err)
+
+	if err != mgo.ErrNotFound {
+		utils.Check(err)
+	}
 
 }
 
-func Buy_order_placed(row_id, tx_id string, quantity, buy_price float64) {
+// side is either "sell" or "buy"
+func Conversion_updated(row_id, side string, leg utils.Leg) {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
 	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
-	change := bson.M{"$set": bson.M{"status": utils.BuyPlaced, "buy_tx_id": tx_id, "buy_price": buy_price, "buy_quantity": quantity}}
+	change := bson.M{"$set": bson.M{side + "_conversion": leg}}
 	err := collection.Update(query, change)
 	utils.Check(err)
 
 }
 
-func Buy_order_completed(row_id string) {
+func Transfer_completed(row_id, deposit_id string) {
+
+	transition(row_id, utils.TransferStarted, utils.TransferCompleted, "transfer arrived", bson.M{"deposit_id": deposit_id})
+
+}
+
+// transfer trades buy after the transfer completes
+// inventory trades right after the sell
+func Buy_order_placed(row_id string, from utils.Status, tx_id string, quantity, buy_price float64) {
+
+	transition(row_id, from, utils.BuyPlaced, "buy order placed", bson.M{"buy_tx_id": tx_id, "buy_price": buy_price, "buy_quantity": quantity})
+
+}
+
+// a timed out order was cancelled and placed again
+// status stays the same, the replacement is kept in history
+func Order_replaced(row_id string, status utils.Status, side, tx_id string, quantity, price float64, reason string) bool {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
-	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
-	change := bson.M{"$set": bson.M{"status": utils.BuyCompleted}}
+	fields := bson.M{side + "_tx_id": tx_id, side + "_quantity": quantity, side + "_price": price}
+	history := utils.Transition{From: status, To: status, Reason: reason, Timestamp: time.Now()}
+
+	query := bson.M{"_id": bson.ObjectIdHex(row_id), "status": status}
+	change := bson.M{"$set": fields, "$push": bson.M{"history": history}}
 	err := collection.Update(query, change)
+
+	if err == mgo.ErrNotFound {
+		Log(fmt.Sprintf("Transaction %s is no longer at status %d, skipping.", row_id, status))
+		return false
+	}
+
 	utils.Check(err)
 
+	return true
+
+}
+
+func Buy_order_completed(row_id string, order utils.Order_status) {
+
+	fields := bson.M{"buy_cost": order.Cost() + order.Fee, "buy_quantity": order.Quantity, "buy_price": order.Price}
+	transition(row_id, utils.BuyPlaced, utils.BuyCompleted, fmt.Sprintf("buy order filled %f at %f", order.Quantity, order.Price), fields)
+
 }
 
 func Token_reset_completed(row_id, transaction_id string) {
 
+	transition(row_id, utils.BuyCompleted, utils.BalancesReset, "balances reset", nil)
+
+}
+
+func Transaction_failed(row_id string, from utils.Status, reason string) {
+
+	transition(row_id, from, utils.Failed, reason, nil)
+
+}
+
+func Transaction_cancelled(row_id string, from utils.Status, reason string) {
+
+	transition(row_id, from, utils.Cancelled, reason, nil)
+
+}
+
+func Get_incomplete_transactions() []utils.Transaction {
+
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
-	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
-	change := bson.M{"$set": bson.M{"status": utils.BalancesReset}}
-	err := collection.Update(query, change)
+	var transactions []utils.Transaction
+
+	query := bson.M{"status": bson.M{"$lt": utils.BalancesReset}, "paper": paper_filter()}
+
+	err := collection.Find(query).All(&transactions)
 	utils.Check(err)
 
+	return transactions
+
 }
 
-func Get_incomplete_transactions() []utils.Transaction {
+func Count_open_transactions(token string) int {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C(transactions_collection)
+
+	query := bson.M{"status": bson.M{"$lt": utils.BalancesReset}, "token": token, "paper": paper_filter()}
+
+	count, err := collection.Find(query).Count()
+	utils.Check(err)
+
+	return count
+
+}
+
+func Get_completed_transactions() []utils.Transaction {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("transactions")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
 	var transactions []utils.Transaction
 
-	query := bson.M{"status": bson.M{"$lt": utils.BalancesReset}}
+	query := bson.M{"status": utils.BalancesReset}
 	err := collection.Find(query).All(&transactions)
 	utils.Check(err)
 
@@ -175,10 +371,11 @@ func Save_comparisons(comparisons map[string]utils.Comparison) {
 
 	var rows []interface{}
 
-	for token, comparison := range comparisons {
+	for pair, comparison := range comparisons {
 
 		row := bson.M{
-			"token":      token,
+			"token":      utils.Pair_token(pair),
+			"pair":       pair,
 			"comparison": comparison,
 			"timestamp":  time.Now(),
 		}
@@ -228,6 +425,81 @@ func Save_prices(exchange_prices map[string]map[string]float64) {
 
 }
 
+// latest recorded price of every token on one exchange
+// within the given time window, ex: ["NULS-ETH"] = 0.0042
+func Get_exchange_prices(exchange string, from_date, to_date time.Time) map[string]float64 {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("prices")
+
+	var rows []Price
+	var prices = make(map[string]float64)
+
+	query := bson.M{"exchange": exchange, "timestamp": bson.M{"$gt": from_date, "$lte": to_date}}
+	err := collection.Find(query).Sort("timestamp").All(&rows)
+	utils.Check(err)
+
+	for _, row := range rows {
+		prices[row.Token] = row.Price
+	}
+
+	return prices
+
+}
+
+// walks the prices collection in time order and hands over
+// one snapshot of all exchanges per minute of recorded history
+// ex: fn(time, ["binance"]["NULS-ETH"] = 0.0042)
+func Stream_prices(from_date, to_date time.Time, fn func(time.Time, map[string]map[string]float64) bool) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("prices")
+
+	var row Price
+	var minute time.Time
+	var snapshot = make(map[string]map[string]float64)
+
+	query := bson.M{"timestamp": bson.M{"$gte": from_date, "$lt": to_date}}
+	iter := collection.Find(query).Sort("timestamp").Iter()
+
+	for iter.Next(&row) {
+
+		at := row.Timestamp.Truncate(time.Minute)
+
+		// prices saved by one run all fall within the same minute
+		if at != minute && len(snapshot) > 0 {
+
+			if !fn(minute, snapshot) {
+				iter.Close()
+				return
+			}
+
+			snapshot = make(map[string]map[string]float64)
+
+		}
+
+		minute = at
+
+		if snapshot[row.Exchange] == nil {
+			snapshot[row.Exchange] = make(map[string]float64)
+		}
+
+		snapshot[row.Exchange][row.Token] = row.Price
+
+	}
+
+	if len(snapshot) > 0 {
+		fn(minute, snapshot)
+	}
+
+	utils.Check(iter.Close())
+
+}
+
 func Save_balances(exchange_balances map[string]map[string]float64) {
 
 	session := mgoSession.Clone()
@@ -284,7 +556,7 @@ func Get_transactions(from_date, to_date time.Time) []utils.Transaction {
 	session := mgoSession.Clone()
 	defer session.Close()
 
-	collection := session.DB(mgoDatabase).C("balances")
+	collection := session.DB(mgoDatabase).C(transactions_collection)
 
 	var transactions []utils.Transaction
 
@@ -351,6 +623,329 @@ func Get_token_analysis(token string) utils.Analysis {
 
 }
 
+//-----------------------------------//
+// rebalancing transfers
+//-----------------------------------//
+func Rebalance_started(rebalance utils.Rebalance) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("rebalances")
+
+	rebalance.Paper = paper_trading
+	rebalance.Timestamp = time.Now()
+
+	if err := collection.Insert(rebalance); err != nil {
+		panic(err)
+	}
+
+}
+
+func Rebalance_txid_resolved(row_id, txid string) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("rebalances")
+
+	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
+	change := bson.M{"$set": bson.M{"txid": txid}}
+	err := collection.Update(query, change)
+	utils.Check(err)
+
+}
+
+func Rebalance_landed(row_id, deposit_id string) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("rebalances")
+
+	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
+	change := bson.M{"$set": bson.M{"landed": true, "landed_at": time.Now(), "deposit_id": deposit_id}}
+	err := collection.Update(query, change)
+	utils.Check(err)
+
+}
+
+// deposits on an exchange already matched to a transfer
+// by transactions and rebalances, so none is matched twice
+func Get_matched_deposits(exchange string) map[string]bool {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	matched := make(map[string]bool)
+
+	var transactions []utils.Transaction
+
+	query := bson.M{"buy_exchange": exchange, "deposit_id": bson.M{"$nin": []interface{}{"", nil}}, "paper": paper_filter()}
+	err := session.DB(mgoDatabase).C(transactions_collection).Find(query).Select(bson.M{"deposit_id": 1}).All(&transactions)
+	utils.Check(err)
+
+	for _, t := range transactions {
+		matched[t.Deposit_id] = true
+	}
+
+	var rebalances []utils.Rebalance
+
+	query = bson.M{"to_exchange": exchange, "deposit_id": bson.M{"$nin": []interface{}{"", nil}}, "paper": paper_filter()}
+	err = session.DB(mgoDatabase).C("rebalances").Find(query).Select(bson.M{"deposit_id": 1}).All(&rebalances)
+	utils.Check(err)
+
+	for _, r := range rebalances {
+		matched[r.Deposit_id] = true
+	}
+
+	return matched
+
+}
+
+func Get_pending_rebalances() []utils.Rebalance {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("rebalances")
+
+	var rebalances []utils.Rebalance
+
+	query := bson.M{"landed": false, "paper": paper_filter()}
+	err := collection.Find(query).All(&rebalances)
+	utils.Check(err)
+
+	return rebalances
+
+}
+
+//-----------------------------------//
+// profit and loss ledger
+//-----------------------------------//
+
+func Get_unledgered_transactions() []utils.Transaction {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C(transactions_collection)
+
+	var transactions []utils.Transaction
+
+	query := bson.M{"status": utils.BalancesReset, "ledgered": bson.M{"$ne": true}, "paper": paper_filter()}
+	err := collection.Find(query).All(&transactions)
+	utils.Check(err)
+
+	return transactions
+
+}
+
+// entries are written before the transaction is marked
+// so a crash in between is retried rather than lost
+func Ledger_recorded(row_id string, entries []utils.Ledger_entry) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	ledger := session.DB(mgoDatabase).C("ledger")
+
+	// a retry replaces whatever made it in before
+	_, err := ledger.RemoveAll(bson.M{"trade": row_id})
+	utils.Check(err)
+
+	for _, entry := range entries {
+
+		entry.Paper = paper_trading
+
+		if err := ledger.Insert(entry); err != nil {
+			panic(err)
+		}
+
+	}
+
+	collection := session.DB(mgoDatabase).C(transactions_collection)
+
+	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
+	change := bson.M{"$set": bson.M{"ledgered": true}}
+	err = collection.Update(query, change)
+	utils.Check(err)
+
+}
+
+// realized profit between two dates, grouped by
+// "trade", "token", "quote", "exchanges" or "day"
+func Get_pnl(group string, from_date, to_date time.Time) []utils.Pnl {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("ledger")
+
+	keys := map[string]interface{}{
+		"trade":     "$trade",
+		"token":     "$token",
+		"quote":     "$quote",
+		"exchanges": bson.M{"$concat": []string{"$sell_exchange", " -> ", "$buy_exchange"}},
+		"day":       bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$timestamp"}},
+	}
+
+	key, ok := keys[group]
+
+	if !ok {
+		panic("Unknown profit grouping: " + group)
+	}
+
+	var pnl []utils.Pnl
+
+	pipe := collection.Pipe(
+		[]bson.M{
+			bson.M{
+				"$match": bson.M{
+					"paper":     paper_filter(),
+					"timestamp": bson.M{"$gte": from_date, "$lt": to_date},
+				},
+			},
+			bson.M{
+				"$group": bson.M{
+					"_id":    bson.M{"key": key, "trade": "$trade"},
+					"profit": bson.M{"$sum": "$amount"},
+				},
+			},
+			bson.M{
+				"$group": bson.M{
+					"_id":    "$_id.key",
+					"profit": bson.M{"$sum": "$profit"},
+					"trades": bson.M{"$sum": 1},
+				},
+			},
+			bson.M{
+				"$sort": bson.M{"_id": 1},
+			},
+		},
+	)
+
+	err := pipe.All(&pnl)
+	utils.Check(err)
+
+	return pnl
+
+}
+
+//-----------------------------------//
+// profit sweeps to the cold wallet
+//-----------------------------------//
+
+func Sweep_started(sweep utils.Sweep) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("sweeps")
+
+	sweep.Paper = paper_trading
+	sweep.Timestamp = time.Now()
+
+	if err := collection.Insert(sweep); err != nil {
+		panic(err)
+	}
+
+}
+
+func Get_sweeps() []utils.Sweep {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("sweeps")
+
+	var sweeps []utils.Sweep
+
+	query := bson.M{"paper": paper_filter()}
+	err := collection.Find(query).All(&sweeps)
+	utils.Check(err)
+
+	return sweeps
+
+}
+
+//-----------------------------------//
+// triangular arbitrage
+//-----------------------------------//
+
+// opportunities are kept next to regular comparisons
+// typed apart so token analysis doesn't pick them up
+func Save_triangles(triangles []utils.Triangle) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("comparisons")
+
+	for _, triangle := range triangles {
+
+		row := bson.M{
+			"type":      "triangular",
+			"exchange":  triangle.Exchange,
+			"triangle":  triangle,
+			"timestamp": time.Now(),
+		}
+
+		if err := collection.Insert(row); err != nil {
+			panic(err)
+		}
+
+	}
+
+}
+
+func Place_triangle(triangle utils.Triangle) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("triangles")
+
+	triangle.Paper = paper_trading
+	triangle.Timestamp = time.Now()
+
+	if err := collection.Insert(triangle); err != nil {
+		panic(err)
+	}
+
+}
+
+func Update_triangle_legs(row_id string, legs []utils.Leg, completed bool) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("triangles")
+
+	query := bson.M{"_id": bson.ObjectIdHex(row_id)}
+	change := bson.M{"$set": bson.M{"legs": legs, "completed": completed}}
+	err := collection.Update(query, change)
+	utils.Check(err)
+
+}
+
+func Get_open_triangles() []utils.Triangle {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("triangles")
+
+	var triangles []utils.Triangle
+
+	query := bson.M{"completed": false, "paper": paper_filter()}
+	err := collection.Find(query).All(&triangles)
+	utils.Check(err)
+
+	return triangles
+
+}
+
 //-----------------------------------//
 // utility data storage
 //-----------------------------------//
@@ -392,20 +987,82 @@ func Update_listed_tokens(tokens map[string][]string) {
 
 }
 
+//-----------------------------------//
+// risk rejections
+//-----------------------------------//
+// a refusal seen again within a few runs updates the row
+// of the first one, instead of adding one on every run
+func Risk_rejected(rejection utils.Rejection) {
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("rejections")
+
+	now := time.Now()
+
+	query := bson.M{
+		"action":    rejection.Action,
+		"limit":     rejection.Limit,
+		"exchange":  rejection.Exchange,
+		"market":    rejection.Market,
+		"paper":     paper_filter(),
+		"last_seen": bson.M{"$gte": now.Add(-10 * time.Minute)},
+	}
+	change := bson.M{
+		"$set": bson.M{"amount": rejection.Amount, "reason": rejection.Reason, "last_seen": now},
+		"$inc": bson.M{"count": 1},
+	}
+
+	err := collection.Update(query, change)
+
+	if err == nil {
+		return
+	}
+
+	if err != mgo.ErrNotFound {
+		panic(err)
+	}
+
+	rejection.Count = 1
+	rejection.Paper = paper_trading
+	rejection.Last_seen = now
+	rejection.Timestamp = now
+
+	if err := collection.Insert(rejection); err != nil {
+		panic(err)
+	}
+
+}
+
 //-----------------------------------//
 // flag methods
 //
 // mostly used for killing bot
 // in case of bad transaction
 //-----------------------------------//
-func Flag(message string) {
+// raises a flag, unless the same one is already active
+// returns whether a new flag was raised
+func Flag(severity, scope, target, message string) bool {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
 	collection := session.DB(mgoDatabase).C("flags")
 
+	query := bson.M{"scope": scope, "target": target, "message": message, "cleared": bson.M{"$ne": true}}
+
+	count, err := collection.Find(query).Count()
+	utils.Check(err)
+
+	if count > 0 {
+		return false
+	}
+
 	row := utils.Flag{
+		Severity:  severity,
+		Scope:     scope,
+		Target:    target,
 		Message:   message,
 		Timestamp: time.Now(),
 	}
@@ -414,8 +1071,12 @@ func Flag(message string) {
 		panic(err)
 	}
 
+	return true
+
 }
 
+// flags that haven't been cleared yet
+// flags from before they were scoped have no cleared field at all
 func Get_flags() []utils.Flag {
 
 	session := mgoSession.Clone()
@@ -425,20 +1086,52 @@ func Get_flags() []utils.Flag {
 
 	var flags []utils.Flag
 
-	err := collection.Find(nil).All(&flags)
+	err := collection.Find(bson.M{"cleared": bson.M{"$ne": true}}).Sort("timestamp").All(&flags)
 	utils.Check(err)
 
 	return flags
 
 }
 
+func Acknowledge_flag(flag_id string) bool {
+
+	return update_flag(flag_id, bson.M{"acknowledged": true})
+
+}
+
+// lifts whatever the flag halted, it is kept for the record
+func Clear_flag(flag_id string) bool {
+
+	return update_flag(flag_id, bson.M{"acknowledged": true, "cleared": true})
+
+}
+
 func Clear_flags() {
 
 	session := mgoSession.Clone()
 	defer session.Close()
 
 	collection := session.DB(mgoDatabase).C("flags")
-	collection.RemoveAll(nil)
+
+	_, err := collection.UpdateAll(bson.M{"cleared": bson.M{"$ne": true}}, bson.M{"$set": bson.M{"acknowledged": true, "cleared": true}})
+	utils.Check(err)
+
+}
+
+func update_flag(flag_id string, fields bson.M) bool {
+
+	if !bson.IsObjectIdHex(flag_id) {
+		return false
+	}
+
+	session := mgoSession.Clone()
+	defer session.Close()
+
+	collection := session.DB(mgoDatabase).C("flags")
+
+	err := collection.UpdateId(bson.ObjectIdHex(flag_id), bson.M{"$set": fields})
+
+	return err == nil
 
 }
 
@@ -18,6 +18,12 @@ import (
 
 var auth_token, bot_id, channel_id, host, database, username, password string
 
+// the bot's owner, the only one shown trading profits
+var owner_id string
+
+// quote currencies the bot compares prices in, ie "ETH, BTC"
+var markets string
+
 var session *discordgo.Session
 
 var errors = map[string]string{
@@ -35,13 +41,15 @@ var status = []string{
 	"Wall Street: Money Never Sleeps",
 }
 
-func Initialize(discord_auth_token, discord_bot_id, discord_channel_id string) {
+func Initialize(discord_auth_token, discord_bot_id, discord_channel_id, discord_owner_id string, quotes []string) {
 
 	fmt.Println("initializing discord package")
 
 	auth_token = discord_auth_token
 	bot_id = discord_bot_id
 	channel_id = discord_channel_id
+	owner_id = discord_owner_id
+	markets = strings.Join(quotes, ", ")
 	var err error
 
 	// initialize discord bot
@@ -146,7 +154,7 @@ func message_handler(s *discordgo.Session, m *discordgo.MessageCreate) {
 				}
 
 			} else {
-				message = token + " is not currently supported. The exchanges I monitor aren't trading it on ETH pair."
+				message = token + " is not currently supported. The exchanges I monitor aren't trading it against " + markets + "."
 			}
 
 		} else {
@@ -216,7 +224,7 @@ func message_handler(s *discordgo.Session, m *discordgo.MessageCreate) {
 				message += "Listed on [" + num_exchanges + "]: " + exchanges + ".\n\n"
 				message += "```"
 			} else {
-				message = "None of the exchanges I monitor trade " + token + " on ETH pair."
+				message = "None of the exchanges I monitor trade " + token + " against " + markets + "."
 			}
 
 		} else {
@@ -278,6 +286,82 @@ func message_handler(s *discordgo.Session, m *discordgo.MessageCreate) {
 			message = "Frequency must be a number, decimal or integer."
 		}
 
+	} else if strings.HasPrefix(content, "profit") && author_id == owner_id && owner_id != "" {
+
+		days := 7
+		parts := strings.Split(content, " ")
+
+		if len(parts) > 1 {
+			if d, err := strconv.Atoi(parts[1]); err == nil && d > 0 {
+				days = d
+			}
+		}
+
+		to_date := time.Now()
+		from_date := to_date.AddDate(0, 0, -days)
+
+		message = "```ini\n"
+		message += "Realized profit, last " + strconv.Itoa(days) + " days\n"
+		message += "--------------------------------------------------------------\n"
+
+		for _, p := range mongo.Get_pnl("day", from_date, to_date) {
+			message += "[" + p.Key + "] " + strconv.Itoa(p.Trades) + " trades, " + strconv.FormatFloat(p.Profit, 'f', 5, 64) + " ETH\n"
+		}
+
+		message += "--------------------------------------------------------------\n"
+
+		for _, p := range mongo.Get_pnl("token", from_date, to_date) {
+			message += "[" + p.Key + "] " + strconv.Itoa(p.Trades) + " trades, " + strconv.FormatFloat(p.Profit, 'f', 5, 64) + " ETH\n"
+		}
+
+		message += "```"
+
+	} else if content == "flags" && author_id == owner_id && owner_id != "" {
+
+		flags := mongo.Get_flags()
+
+		message = "```ini\n"
+		message += "Active flags [" + strconv.Itoa(len(flags)) + "]\n"
+		message += "--------------------------------------------------------------\n"
+
+		for _, f := range flags {
+
+			seen := ""
+
+			if f.Acknowledged {
+				seen = " (acknowledged)"
+			}
+
+			message += "[" + f.ID.Hex() + "] " + f.Severity + " " + strings.TrimSpace(f.Scope+" "+f.Target) + seen + "\n"
+			message += f.Message + "\n"
+
+		}
+
+		message += "```"
+
+	} else if strings.HasPrefix(content, "ack ") && author_id == owner_id && owner_id != "" {
+
+		flag_id := strings.Split(content, " ")[1]
+
+		if mongo.Acknowledge_flag(flag_id) {
+			message = "Ok, flag " + flag_id + " acknowledged."
+		} else {
+			message = "I couldn't find flag " + flag_id + "."
+		}
+
+	} else if strings.HasPrefix(content, "clear ") && author_id == owner_id && owner_id != "" {
+
+		flag_id := strings.Split(content, " ")[1]
+
+		if flag_id == "all" {
+			mongo.Clear_flags()
+			message = "Ok, all flags cleared, trading resumes on the next run."
+		} else if mongo.Clear_flag(flag_id) {
+			message = "Ok, flag " + flag_id + " cleared, trading resumes on the next run."
+		} else {
+			message = "I couldn't find flag " + flag_id + "."
+		}
+
 	} else if content == "help" {
 
 		// message = "Alright, here's a list of available commands. Some contain a small example at the end.\n"
@@ -308,11 +392,13 @@ func message_handler(s *discordgo.Session, m *discordgo.MessageCreate) {
 		message = "```ini\n"
 		message += "Your notifications are turned [" + status + "]\n"
 		message += "---\n"
-		message += "I support monitoring of all ETH pairs on the following exchanges:\n\n"
+		message += "I support monitoring of all " + markets + " pairs on the following exchanges:\n\n"
 		message += "• Binance\n"
 		message += "• Kucoin\n"
 		message += "• OKex\n"
 		message += "• Bitz\n"
+		message += "• Bittrex\n"
+		message += "• Poloniex\n"
 		message += "```"
 
 	} else if strings.Contains(content, "serg") {
@@ -348,7 +434,7 @@ func Notify_discorders(comparisons map[string]utils.Comparison) {
 
 			message := ""
 
-			for token, comparison := range comparisons {
+			for pair, comparison := range comparisons {
 
 				// calculte percentage difference
 				difference := (1 - comparison.Min_price/comparison.Max_price) * 100
@@ -356,15 +442,15 @@ func Notify_discorders(comparisons map[string]utils.Comparison) {
 
 				// if this is a token the user wants us to monitor
 				// and the notification threshold matches set prefernce
-				token_match := utils.StringInSlice(token, d.Tokens)
+				token_match := utils.StringInSlice(utils.Pair_token(pair), d.Tokens)
 				threshold_match := difference >= d.Threshold
 				frequency_match := time.Since(d.Last_notification).Minutes() >= d.Frequency
 
 				if token_match && threshold_match && frequency_match {
 
 					string_diff := strconv.FormatFloat(difference, 'f', 0, 64)
-					message += token + " " + string_diff + "% difference between "
-					message += comparison.Min_exchange + "(min) and " + comparison.Max_exchange + "(max)" + " on ETH pair\n"
+					message += utils.Pair_token(pair) + " " + string_diff + "% difference between "
+					message += comparison.Min_exchange + "(min) and " + comparison.Max_exchange + "(max)" + " on " + utils.Pair_quote(pair) + " pair\n"
 
 				}
 
@@ -408,6 +494,17 @@ func Send_daily_summary(message string) {
 
 }
 
+// safety issues that need a human to look at them
+func Send_alert(message string) {
+
+	if session != nil && message != "" {
+
+		session.ChannelMessageSend(channel_id, "Alert: "+message)
+
+	}
+
+}
+
 func is_potty_mouth(message string) bool {
 
 	bad_words := []string{"fuck", "shit", "dick", "bitch", "cunt"}
@@ -9,7 +9,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	// utility
@@ -27,33 +26,53 @@ type Transfer_request struct {
 
 type Deposits struct {
 	List []struct {
-		Amount  float64 `json:"amount,Number"`
-		Asset   string  `json:"asset"`
-		address string  `json:"address"`
-		txId    string  `json:"txId"`
-		status  string  `json:"status"`
+		Amount     float64 `json:"amount,Number"`
+		Asset      string  `json:"asset"`
+		Address    string  `json:"address"`
+		TxId       string  `json:"txId"`
+		Status     int     `json:"status"`
+		InsertTime int64   `json:"insertTime"`
 	} `json:"depositList"`
 	Success bool `json:"success"`
 }
 
+type Withdrawals struct {
+	List []struct {
+		Id     string  `json:"id"`
+		Amount float64 `json:"amount,Number"`
+		Asset  string  `json:"asset"`
+		TxId   string  `json:"txId"`
+	} `json:"withdrawList"`
+	Success bool `json:"success"`
+}
+
 type Place_order struct {
 	Id json.Number `json:"orderId"`
 }
 
 type Order struct {
-	Symbol        string  `json:"symbol"`
-	OrderId       float64 `json:"orderId.string"`
-	ClientOrderId string  `json:"clientOrderId"`
-	Price         float64 `json:"price,string"`
-	OrigQty       float64 `json:"origQty,string"`
-	ExecutedQty   float64 `json:"executedQty,string"`
-	Status        string  `json:"status"`
-	TimeInForce   string  `json:"timeInForce"`
-	Type          string  `json:"type"`
-	Side          string  `json:"side"`
-	StopPrice     float64 `json:"stopPrice,string"`
-	IcebergQty    float64 `json:"icebergQty,string"`
-	IsWorking     bool    `json:"isWorking"`
+	Symbol              string  `json:"symbol"`
+	OrderId             float64 `json:"orderId.string"`
+	ClientOrderId       string  `json:"clientOrderId"`
+	Price               float64 `json:"price,string"`
+	OrigQty             float64 `json:"origQty,string"`
+	ExecutedQty         float64 `json:"executedQty,string"`
+	CummulativeQuoteQty float64 `json:"cummulativeQuoteQty,string"`
+	Status              string  `json:"status"`
+	TimeInForce         string  `json:"timeInForce"`
+	Type                string  `json:"type"`
+	Side                string  `json:"side"`
+	StopPrice           float64 `json:"stopPrice,string"`
+	IcebergQty          float64 `json:"icebergQty,string"`
+	IsWorking           bool    `json:"isWorking"`
+}
+
+// fills of an order, each with the commission it paid
+type Trades []struct {
+	OrderId         int64   `json:"orderId"`
+	Price           float64 `json:"price,string"`
+	Commission      float64 `json:"commission,string"`
+	CommissionAsset string  `json:"commissionAsset"`
 }
 
 type Holdings struct {
@@ -70,6 +89,17 @@ type Prices []struct {
 	Price  string `json:"price"`
 }
 
+type Tickers []struct {
+	Symbol      string `json:"symbol"`
+	Price       string `json:"lastPrice"`
+	QuoteVolume string `json:"quoteVolume"`
+}
+
+type Depth struct {
+	Bids [][]interface{} `json:"bids"`
+	Asks [][]interface{} `json:"asks"`
+}
+
 func Initialize(url, key, secret, eth_fee string) {
 
 	fmt.Println("initializing binance package")
@@ -110,7 +140,7 @@ func Get_balances(tokens map[string]bool) map[string]float64 {
 
 }
 
-func Get_price(tokens map[string]bool) map[string]float64 {
+func Get_price(tokens, quotes map[string]bool) map[string]float64 {
 
 	var endpoint = "/api/v3/ticker/price"
 	var prices = make(map[string]float64)
@@ -121,28 +151,87 @@ func Get_price(tokens map[string]bool) map[string]float64 {
 	body = execute("GET", api_url+endpoint, false)
 
 	err := json.Unmarshal(body, &data)
-	utils.Check(err)
+	if utils.Api_schema_error("binance", err) {
+		return prices
+	}
 
 	// parse data and format for return
 	for _, v := range *data {
 
 		// binance formats pairs as "LINKETH"
 		// we're going to instead use kucoin's format "LINK-ETH"
-		symbol := v.Symbol
-		is_eth_pair := strings.HasSuffix(symbol, "ETH")
-		token := strings.TrimSuffix(symbol, "ETH")
+		pair, ok := utils.Symbol_pair(v.Symbol, "", false, quotes)
 		price, err := strconv.ParseFloat(v.Price, 64)
 		utils.Check(err)
 
-		if is_eth_pair && tokens[token] {
-			prices[token+"-ETH"] = price
+		if ok && tokens[utils.Pair_token(pair)] {
+			prices[pair] = price
 		}
 	}
 
 	return prices
 }
 
-func Get_listed_tokens() []string {
+// 24h statistics, which don't say when the market last traded
+// close time is only the end of the window
+func Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
+
+	var endpoint = "/api/v3/ticker/24hr"
+	var tickers = make(map[string]utils.Ticker)
+	var data = new(Tickers)
+	var body []byte
+
+	// perform api call
+	body = execute("GET", api_url+endpoint, false)
+
+	err := json.Unmarshal(body, &data)
+	if utils.Api_schema_error("binance", err) {
+		return tickers
+	}
+
+	for _, v := range *data {
+
+		pair, ok := utils.Symbol_pair(v.Symbol, "", false, quotes)
+
+		if !ok || !tokens[utils.Pair_token(pair)] {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(v.Price, 64)
+		utils.Check(err)
+
+		volume, err := strconv.ParseFloat(v.QuoteVolume, 64)
+		utils.Check(err)
+
+		tickers[pair] = utils.Ticker{Price: price, Volume: volume}
+
+	}
+
+	return tickers
+
+}
+
+func Get_order_book(pair string) utils.Order_book {
+
+	var symbol = utils.Pair_symbol(pair, "", false)
+	var endpoint = fmt.Sprintf("/api/v1/depth?symbol=%s&limit=%d", symbol, 20)
+	var data = new(Depth)
+	var body []byte
+
+	// perform api call
+	body = execute("GET", api_url+endpoint, false)
+
+	err := json.Unmarshal(body, &data)
+	utils.Check(err)
+
+	return utils.Sort_order_book(utils.Order_book{
+		Bids: utils.Parse_levels(data.Bids),
+		Asks: utils.Parse_levels(data.Asks),
+	})
+
+}
+
+func Get_listed_tokens(quotes map[string]bool) []string {
 
 	var endpoint = "/api/v3/ticker/price"
 	var tokens []string
@@ -159,23 +248,21 @@ func Get_listed_tokens() []string {
 	for _, v := range *data {
 
 		// binance formats pairs as "LINKETH"
-		// we're going to instead use kucoin's format "LINK-ETH"
-		symbol := v.Symbol
-		is_eth_pair := strings.HasSuffix(symbol, "ETH")
-		token := strings.TrimSuffix(symbol, "ETH")
+		// a token listed on several quotes is only counted once
+		pair, ok := utils.Symbol_pair(v.Symbol, "", false, quotes)
 
-		if is_eth_pair {
-			tokens = append(tokens, token)
+		if ok && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
 		}
 	}
 
 	return tokens
 }
 
-func Place_sell_order(token string, quantity int, price float64) (transaction_id string, sell_placed bool) {
+func Place_sell_order(pair string, quantity, price float64) (transaction_id string, sell_placed bool) {
 
-	token += "ETH"
-	var endpoint = fmt.Sprintf("/api/v3/order?symbol=%s&side=%s&type=%s&quantity=%d&price=%f&timeInForce=GTC", token, "SELL", "LIMIT", quantity, price)
+	var symbol = utils.Pair_symbol(pair, "", false)
+	var endpoint = fmt.Sprintf("/api/v3/order?symbol=%s&side=%s&type=%s&quantity=%f&price=%f&timeInForce=GTC", symbol, "SELL", "LIMIT", quantity, price)
 	var place_order = new(Place_order)
 	var body []byte
 
@@ -193,10 +280,10 @@ func Place_sell_order(token string, quantity int, price float64) (transaction_id
 
 }
 
-func Check_if_sold(token, sell_tx_id string) (float64, bool) {
+func Get_order(pair, side, order_id string) utils.Order_status {
 
-	token += "ETH"
-	var endpoint = fmt.Sprintf("/api/v3/order?orderId=%s&symbol=%s", sell_tx_id, token)
+	var symbol = utils.Pair_symbol(pair, "", false)
+	var endpoint = fmt.Sprintf("/api/v3/order?orderId=%s&symbol=%s", order_id, symbol)
 	var order = new(Order)
 	var body []byte
 
@@ -206,17 +293,61 @@ func Check_if_sold(token, sell_tx_id string) (float64, bool) {
 	err := json.Unmarshal(body, &order)
 	utils.Check(err)
 
-	if order.OrigQty != 0 && order.OrigQty == order.ExecutedQty {
-		return order.OrigQty * order.Price, true
+	// anything but a final status, including none at all
+	// on a bad response, is treated as still on the book
+	closed := order.Status == "FILLED" || order.Status == "CANCELED" || order.Status == "EXPIRED" || order.Status == "REJECTED"
+	status := utils.Order_status{Open: !closed, Quantity: order.ExecutedQty}
+
+	if order.ExecutedQty > 0 {
+		status.Price = order.CummulativeQuoteQty / order.ExecutedQty
+		status.Fee = get_order_fee(pair, order_id)
+	}
+
+	return status
+
+}
+
+// the order itself leaves out commission, its trades have it
+// paid in the quote, or in the token on buys, which is converted
+// commission paid in BNB isn't taken out of the trade and is left out
+func get_order_fee(pair, order_id string) float64 {
+
+	var symbol = utils.Pair_symbol(pair, "", false)
+	var endpoint = fmt.Sprintf("/api/v3/myTrades?symbol=%s", symbol)
+	var trades = Trades{}
+	var body []byte
+	var fee float64
+
+	// perform api call
+	body = execute("GET", api_url+endpoint, true)
+
+	err := json.Unmarshal(body, &trades)
+	if utils.Api_schema_error("binance", err) {
+		return 0
+	}
+
+	for _, t := range trades {
+
+		if strconv.FormatInt(t.OrderId, 10) != order_id {
+			continue
+		}
+
+		switch t.CommissionAsset {
+		case utils.Pair_quote(pair):
+			fee += t.Commission
+		case utils.Pair_token(pair):
+			fee += t.Commission * t.Price
+		}
+
 	}
 
-	return 0.0, false
+	return fee
 
 }
 
-func Start_transfer(token, destination string, amount float64) (string, bool) {
+func Start_transfer(asset, destination string, amount float64) (string, bool) {
 
-	var endpoint = fmt.Sprintf("/wapi/v3/withdraw.html?address=%s&amount=%f&asset=%s&name=bot", destination, amount, token)
+	var endpoint = fmt.Sprintf("/wapi/v3/withdraw.html?address=%s&amount=%f&asset=%s&name=bot", destination, amount, asset)
 	var transfer = new(Transfer_request)
 	var body []byte
 
@@ -234,10 +365,33 @@ func Start_transfer(token, destination string, amount float64) (string, bool) {
 
 }
 
-func Check_if_transferred(sell_cost float64) bool {
+func Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
 
-	var endpoint = fmt.Sprintf("/wapi/v3/depositHistory.html?asset=ETH&status=1")
+	var endpoint = fmt.Sprintf("/wapi/v3/withdrawHistory.html?asset=%s", asset)
+	var withdrawals = new(Withdrawals)
+	var body []byte
+
+	// perform api call
+	body = execute("GET", api_url+endpoint, true)
+
+	err := json.Unmarshal(body, &withdrawals)
+	utils.Check(err)
+
+	for _, w := range withdrawals.List {
+		if w.Id == withdrawal_id && w.TxId != "" {
+			return w.TxId, true
+		}
+	}
+
+	return "", false
+
+}
+
+func Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+
+	var endpoint = fmt.Sprintf("/wapi/v3/depositHistory.html?asset=%s&status=1", asset)
 	var deposits = new(Deposits)
+	var list []utils.Deposit
 	var body []byte
 
 	// perform api call
@@ -246,20 +400,24 @@ func Check_if_transferred(sell_cost float64) bool {
 	err := json.Unmarshal(body, &deposits)
 	utils.Check(err)
 
+	// binance deposits have no id of their own
 	for _, d := range deposits.List {
-		if d.Amount == sell_cost {
-			return true
-		}
+		list = append(list, utils.Deposit{
+			Id:        d.TxId,
+			Txid:      d.TxId,
+			Amount:    d.Amount,
+			Timestamp: time.Unix(0, d.InsertTime*int64(time.Millisecond)),
+		})
 	}
 
-	return false
+	return utils.Match_deposit(list, txid, amount, since, matched)
 
 }
 
-func Place_buy_order(token string, quantity, price float64) (string, bool) {
+func Place_buy_order(pair string, quantity, price float64) (string, bool) {
 
-	token += "ETH"
-	var endpoint = fmt.Sprintf("/api/v3/order?symbol=%s&side=%s&type=%s&quantity=%f&price=%f&timeInForce=GTC", token, "BUY", "LIMIT", quantity, price)
+	var symbol = utils.Pair_symbol(pair, "", false)
+	var endpoint = fmt.Sprintf("/api/v3/order?symbol=%s&side=%s&type=%s&quantity=%f&price=%f&timeInForce=GTC", symbol, "BUY", "LIMIT", quantity, price)
 	var place_order = new(Place_order)
 	var body []byte
 
@@ -277,20 +435,20 @@ func Place_buy_order(token string, quantity, price float64) (string, bool) {
 
 }
 
-func Check_if_bought(token, buy_tx_id string) bool {
+func Cancel_order(pair, side, order_id string) bool {
 
-	token += "ETH"
-	var endpoint = fmt.Sprintf("/api/v3/order?orderId=%s&symbol=%s", buy_tx_id, token)
+	var symbol = utils.Pair_symbol(pair, "", false)
+	var endpoint = fmt.Sprintf("/api/v3/order?orderId=%s&symbol=%s", order_id, symbol)
 	var order = new(Order)
 	var body []byte
 
 	// perform api call
-	body = execute("GET", api_url+endpoint, true)
+	body = execute("DELETE", api_url+endpoint, true)
 
 	err := json.Unmarshal(body, &order)
 	utils.Check(err)
 
-	if order.OrigQty != 0 && order.OrigQty == order.ExecutedQty {
+	if order.Status == "CANCELED" {
 		return true
 	}
 
@@ -323,11 +481,26 @@ func execute(method string, url string, auth bool) []byte {
 		req.URL.RawQuery = q.Encode() + "&signature=" + signature
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: utils.Request_timeout}
+
+	utils.Wait_turn("binance")
 
+	started := time.Now()
 	res, err := client.Do(req)
 	utils.Check(err)
 
+	status := 0
+
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	utils.Api_call("binance", started, status, err)
+
+	if res == nil {
+		return nil
+	}
+
 	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
@@ -0,0 +1,107 @@
+package binance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	// common exchange interface and registry
+	"../../exchanges"
+)
+
+// stands in for binance's order endpoints, the order stays open
+// until it's cancelled, having filled 4 of 10 by then
+// refusing answers cancels the way binance does for unknown orders
+func stand_in(t *testing.T, refuse bool) (*httptest.Server, *url.Values) {
+
+	cancelled := false
+	cancel := new(url.Values)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+
+		if r.Header.Get("X-MBX-APIKEY") != "key" || query.Get("timestamp") == "" || query.Get("signature") == "" {
+			t.Errorf("%s %s sent unsigned", r.Method, r.URL.Path)
+		}
+
+		switch r.Method + " " + r.URL.Path {
+
+		case "DELETE /api/v3/order":
+			*cancel = query
+
+			if refuse {
+				w.Write([]byte(`{"code": -2011, "msg": "Unknown order sent."}`))
+				return
+			}
+
+			cancelled = true
+			w.Write([]byte(`{"symbol": "LINKETH", "orderId": 42, "status": "CANCELED", "executedQty": "4.00000000"}`))
+
+		case "GET /api/v3/order":
+			if cancelled {
+				w.Write([]byte(`{"symbol": "LINKETH", "orderId": 42, "price": "0.00200000", "origQty": "10.00000000", "executedQty": "4.00000000", "cummulativeQuoteQty": "0.00800000", "status": "CANCELED", "side": "SELL"}`))
+			} else {
+				w.Write([]byte(`{"symbol": "LINKETH", "orderId": 42, "price": "0.00200000", "origQty": "10.00000000", "executedQty": "4.00000000", "cummulativeQuoteQty": "0.00800000", "status": "PARTIALLY_FILLED", "side": "SELL"}`))
+			}
+
+		case "GET /api/v3/myTrades":
+			w.Write([]byte(`[
+				{"id": 1, "orderId": 41, "price": "0.00190000", "qty": "10.00000000", "commission": "0.00001900", "commissionAsset": "ETH"},
+				{"id": 2, "orderId": 42, "price": "0.00200000", "qty": "3.00000000", "commission": "0.00000600", "commissionAsset": "ETH"},
+				{"id": 3, "orderId": 42, "price": "0.00200000", "qty": "1.00000000", "commission": "0.00000200", "commissionAsset": "ETH"}
+			]`))
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+
+		}
+
+	}))
+
+	api_url = server.URL
+	api_key = "key"
+	api_secret = "secret"
+
+	return server, cancel
+
+}
+
+func TestCancel_order(t *testing.T) {
+
+	server, cancel := stand_in(t, false)
+	defer server.Close()
+
+	if order := Get_order("LINK-ETH", "sell", "42"); !order.Open || order.Quantity != 4 {
+		t.Errorf("partially filled order parsed as %+v", order)
+	}
+
+	order, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "42")
+
+	if cancel.Get("orderId") != "42" || cancel.Get("symbol") != "LINKETH" {
+		t.Errorf("cancel sent as %v", *cancel)
+	}
+
+	// fee only counts the trades of this order
+	if !cancelled || !order.Done() || order.Quantity != 4 || order.Price != 0.002 || order.Fee != 0.000008 {
+		t.Errorf("cancelled order reported as %+v, %v", order, cancelled)
+	}
+
+}
+
+func TestCancel_order_refused(t *testing.T) {
+
+	server, _ := stand_in(t, true)
+	defer server.Close()
+
+	if Cancel_order("LINK-ETH", "sell", "42") {
+		t.Error("refused cancel reported as cancelled")
+	}
+
+	if _, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "42"); cancelled {
+		t.Error("order still open after a refused cancel reported as cancelled")
+	}
+
+}
@@ -1,21 +1,485 @@
 package bittrex
 
 import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	// utility
+	"../../utils"
 )
 
-var url, key, secret string
+var api_url, api_key, api_secret string
+var api_eth_fee float64
+
+type Transfer_request struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Result  struct {
+		Id string `json:"uuid"`
+	} `json:"result"`
+}
+
+type Deposits struct {
+	Success bool `json:"success"`
+	Result  []struct {
+		Id            float64 `json:"Id"`
+		Amount        float64 `json:"Amount"`
+		Currency      string  `json:"Currency"`
+		Confirmations int     `json:"Confirmations"`
+		TxId          string  `json:"TxId"`
+		CryptoAddress string  `json:"CryptoAddress"`
+		LastUpdated   string  `json:"LastUpdated"`
+	} `json:"result"`
+}
+
+type Withdrawals struct {
+	Success bool `json:"success"`
+	Result  []struct {
+		PaymentUuid string  `json:"PaymentUuid"`
+		Amount      float64 `json:"Amount"`
+		Currency    string  `json:"Currency"`
+		TxId        string  `json:"TxId"`
+	} `json:"result"`
+}
+
+type Place_order struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Result  struct {
+		Id string `json:"uuid"`
+	} `json:"result"`
+}
+
+type Cancel_request struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+type Order struct {
+	Success bool `json:"success"`
+	Result  struct {
+		OrderUuid         string  `json:"OrderUuid"`
+		Exchange          string  `json:"Exchange"`
+		Type              string  `json:"Type"`
+		Quantity          float64 `json:"Quantity"`
+		QuantityRemaining float64 `json:"QuantityRemaining"`
+		Limit             float64 `json:"Limit"`
+		CommissionPaid    float64 `json:"CommissionPaid"`
+		Price             float64 `json:"Price"`
+		PricePerUnit      float64 `json:"PricePerUnit"`
+		IsOpen            bool    `json:"IsOpen"`
+	} `json:"result"`
+}
+
+type Holdings struct {
+	Success bool      `json:"success"`
+	Result  []Holding `json:"result"`
+}
+
+type Holding struct {
+	Symbol string  `json:"Currency"`
+	Amount float64 `json:"Available"`
+}
+
+type Prices struct {
+	Success bool    `json:"success"`
+	Prices  []Price `json:"result"`
+}
+
+type Price struct {
+	Symbol     string  `json:"MarketName"`
+	Price      float64 `json:"Last"`
+	BaseVolume float64 `json:"BaseVolume"`
+	TimeStamp  string  `json:"TimeStamp"`
+}
+
+type Depth struct {
+	Success bool `json:"success"`
+	Result  struct {
+		Buy []struct {
+			Quantity float64 `json:"Quantity"`
+			Rate     float64 `json:"Rate"`
+		} `json:"buy"`
+		Sell []struct {
+			Quantity float64 `json:"Quantity"`
+			Rate     float64 `json:"Rate"`
+		} `json:"sell"`
+	} `json:"result"`
+}
+
+func Initialize(url, key, secret, eth_fee string) {
+
+	fmt.Println("initializing bittrex package")
+
+	api_url = url
+	api_key = key
+	api_secret = secret
+	api_eth_fee, _ = strconv.ParseFloat(eth_fee, 64)
+
+}
+
+func Get_balances(tokens map[string]bool) map[string]float64 {
+
+	var endpoint = "/api/v1.1/account/getbalances"
+	var holdings = make(map[string]float64)
+	var data = new(Holdings)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, "", true)
+
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return holdings
+	}
+
+	// remove tokens that we don't care about
+	for _, v := range data.Result {
+
+		if tokens[v.Symbol] {
+			holdings[v.Symbol] = v.Amount
+		}
+
+	}
+
+	return holdings
+
+}
+
+func Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	return utils.Ticker_prices(Get_tickers(tokens, quotes))
+
+}
+
+func Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
+
+	var endpoint = "/api/v1.1/public/getmarketsummaries"
+	var tickers = make(map[string]utils.Ticker)
+	var data = new(Prices)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, "", false)
+
+	err := json.Unmarshal(body, &data)
+	if utils.Api_schema_error("bittrex", err) {
+		return tickers
+	}
+
+	// parse data and format for return
+	for _, v := range data.Prices {
+
+		// bittrex formats pairs backwards as "ETH-LINK"
+		// we're going to instead use kucoin's format "LINK-ETH"
+		pair, ok := utils.Symbol_pair(v.Symbol, "-", true, quotes)
+
+		if ok && tokens[utils.Pair_token(pair)] && v.Price > 0 {
+
+			// bittrex's base is our quote, timestamps are UTC
+			timestamp, _ := time.Parse("2006-01-02T15:04:05.999", v.TimeStamp)
+
+			tickers[pair] = utils.Ticker{
+				Price:     v.Price,
+				Volume:    v.BaseVolume,
+				Timestamp: timestamp,
+			}
+
+		}
+	}
+
+	return tickers
+
+}
+
+func Get_order_book(pair string) utils.Order_book {
+
+	var endpoint = "/api/v1.1/public/getorderbook"
+	var params = fmt.Sprintf("market=%s&type=both", utils.Pair_symbol(pair, "-", true))
+	var book = utils.Order_book{}
+	var data = new(Depth)
+	var body []byte
 
-func Initialize(api_url string, api_key string, api_secret string) {
+	// perform api call
+	body = execute(endpoint, params, false)
 
-	url = api_url
-	key = api_key
-	secret = api_secret
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return book
+	}
+
+	for _, level := range data.Result.Buy {
+		book.Bids = append(book.Bids, utils.Order_level{Price: level.Rate, Quantity: level.Quantity})
+	}
+
+	for _, level := range data.Result.Sell {
+		book.Asks = append(book.Asks, utils.Order_level{Price: level.Rate, Quantity: level.Quantity})
+	}
+
+	return utils.Sort_order_book(book)
 
 }
 
-func Test() {
+func Get_listed_tokens(quotes map[string]bool) []string {
+
+	var endpoint = "/api/v1.1/public/getmarketsummaries"
+	var tokens []string
+	var data = new(Prices)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, "", false)
+
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return tokens
+	}
+
+	// parse data and format for return
+	for _, v := range data.Prices {
+
+		// bittrex formats pairs backwards as "ETH-LINK"
+		// a token listed on several quotes is only counted once
+		pair, ok := utils.Symbol_pair(v.Symbol, "-", true, quotes)
+
+		if ok && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
+		}
+	}
+
+	return tokens
+
+}
+
+func Place_sell_order(pair string, quantity, price float64) (transaction_id string, sell_placed bool) {
+
+	var endpoint = "/api/v1.1/market/selllimit"
+	var params = fmt.Sprintf("market=%s&quantity=%f&rate=%f", utils.Pair_symbol(pair, "-", true), quantity, price)
+	var place_order = new(Place_order)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &place_order)
+	utils.Check(err)
+
+	if !place_order.Success || place_order.Result.Id == "" {
+		return "", false
+	}
+
+	return place_order.Result.Id, true
+
+}
+
+func Get_order(pair, side, order_id string) utils.Order_status {
+
+	var endpoint = "/api/v1.1/account/getorder"
+	var params = fmt.Sprintf("uuid=%s", order_id)
+	var order = new(Order)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &order)
+	utils.Check(err)
+
+	// commission is taken out of what we receive
+	return utils.Order_status{
+		Open:     !order.Success || order.Result.IsOpen,
+		Quantity: order.Result.Quantity - order.Result.QuantityRemaining,
+		Price:    order.Result.PricePerUnit,
+		Fee:      order.Result.CommissionPaid,
+	}
+
+}
+
+func Start_transfer(asset, destination string, amount float64) (string, bool) {
+
+	var endpoint = "/api/v1.1/account/withdraw"
+	var params = fmt.Sprintf("address=%s&currency=%s&quantity=%f", destination, asset, amount)
+	var transfer = new(Transfer_request)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &transfer)
+	utils.Check(err)
+
+	if !transfer.Success || transfer.Result.Id == "" {
+		return "", false
+	}
+
+	return transfer.Result.Id, true
+
+}
+
+func Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
+
+	var endpoint = "/api/v1.1/account/getwithdrawalhistory"
+	var params = "currency=" + asset
+	var withdrawals = new(Withdrawals)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &withdrawals)
+	utils.Check(err)
+
+	for _, w := range withdrawals.Result {
+		if w.PaymentUuid == withdrawal_id && w.TxId != "" {
+			return w.TxId, true
+		}
+	}
+
+	return "", false
+
+}
+
+func Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+
+	var endpoint = "/api/v1.1/account/getdeposithistory"
+	var params = "currency=" + asset
+	var deposits = new(Deposits)
+	var list []utils.Deposit
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &deposits)
+	utils.Check(err)
+
+	// bittrex only lists deposits in history
+	// once they have been credited to the account
+	for _, d := range deposits.Result {
+
+		// timestamps are UTC
+		timestamp, _ := time.Parse("2006-01-02T15:04:05.999", d.LastUpdated)
+
+		list = append(list, utils.Deposit{
+			Id:        strconv.FormatFloat(d.Id, 'f', 0, 64),
+			Txid:      d.TxId,
+			Amount:    d.Amount,
+			Timestamp: timestamp,
+		})
+
+	}
+
+	return utils.Match_deposit(list, txid, amount, since, matched)
+
+}
+
+func Place_buy_order(pair string, quantity, price float64) (string, bool) {
+
+	var endpoint = "/api/v1.1/market/buylimit"
+	var params = fmt.Sprintf("market=%s&quantity=%f&rate=%f", utils.Pair_symbol(pair, "-", true), quantity, price)
+	var place_order = new(Place_order)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &place_order)
+	utils.Check(err)
+
+	if !place_order.Success || place_order.Result.Id == "" {
+		return "", false
+	}
+
+	return place_order.Result.Id, true
+
+}
+
+func Cancel_order(pair, side, order_id string) bool {
+
+	var endpoint = "/api/v1.1/market/cancel"
+	var params = fmt.Sprintf("uuid=%s", order_id)
+	var cancel_order = new(Cancel_request)
+	var body []byte
+
+	// perform api call
+	body = execute(endpoint, params, true)
+
+	err := json.Unmarshal(body, &cancel_order)
+	utils.Check(err)
+
+	return cancel_order.Success
+
+}
+
+func make_signature(uri string) string {
+
+	mac := hmac.New(sha512.New, []byte(api_secret))
+	mac.Write([]byte(uri))
+	return hex.EncodeToString(mac.Sum(nil))
+
+}
+
+func execute(endpoint string, params string, auth bool) []byte {
+
+	var uri = api_url + endpoint + "?" + params
+
+	if auth {
+
+		// bittrex signs the full uri, including key and nonce
+		// and expects the signature in the apisign header
+		nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+		if params != "" {
+			uri += "&"
+		}
+
+		uri += "apikey=" + api_key + "&nonce=" + nonce
+
+	}
+
+	req, err := http.NewRequest("GET", uri, nil)
+	utils.Check(err)
+
+	req.Header.Add("Accept", "application/json")
+
+	if auth {
+		req.Header.Add("apisign", make_signature(uri))
+	}
+
+	client := &http.Client{Timeout: utils.Request_timeout}
+
+	utils.Wait_turn("bittrex")
+
+	started := time.Now()
+	res, err := client.Do(req)
+	utils.Check(err)
+
+	status := 0
+
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	utils.Api_call("bittrex", started, status, err)
+
+	if res != nil {
+
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		utils.Check(err)
+
+		return body
+
+	}
 
-	fmt.Println(url)
+	return nil
 
 }
@@ -0,0 +1,241 @@
+package bittrex
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	// common exchange interface and registry
+	"../../exchanges"
+)
+
+// stands in for the bittrex rest api, answering each path
+// with its canned response and keeping the last request
+func stand_in(t *testing.T, responses map[string]string) (*httptest.Server, *http.Request) {
+
+	last := new(http.Request)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		*last = *r
+
+		response, ok := responses[r.URL.Path]
+
+		if !ok {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(response))
+
+	}))
+
+	api_url = server.URL
+	api_key = "key"
+	api_secret = "secret"
+
+	return server, last
+
+}
+
+func TestSignature(t *testing.T) {
+
+	server, last := stand_in(t, map[string]string{
+		"/api/v1.1/account/getbalances": `{"success": true, "result": [{"Currency": "ETH", "Available": 1.5}]}`,
+	})
+	defer server.Close()
+
+	Get_balances(map[string]bool{"ETH": true})
+
+	query := last.URL.Query()
+
+	if query.Get("apikey") != "key" || query.Get("nonce") == "" {
+		t.Fatalf("apikey and nonce missing from %s", last.URL.RawQuery)
+	}
+
+	// signed over the full uri, key and nonce included
+	mac := hmac.New(sha512.New, []byte("secret"))
+	mac.Write([]byte(server.URL + last.URL.RequestURI()))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if signature := last.Header.Get("apisign"); signature != expected {
+		t.Errorf("apisign is %s, expected %s", signature, expected)
+	}
+
+}
+
+func TestGet_tickers(t *testing.T) {
+
+	server, _ := stand_in(t, map[string]string{
+		"/api/v1.1/public/getmarketsummaries": `{"success": true, "result": [
+			{"MarketName": "ETH-LINK", "Last": 0.0012, "BaseVolume": 85.5, "TimeStamp": "2018-03-01T10:00:00.5"},
+			{"MarketName": "BTC-LINK", "Last": 0.00009, "BaseVolume": 4.2, "TimeStamp": "2018-03-01T10:00:01"},
+			{"MarketName": "ETH-OMG", "Last": 0.02, "BaseVolume": 300, "TimeStamp": "2018-03-01T10:00:02"},
+			{"MarketName": "USDT-LINK", "Last": 0.9, "BaseVolume": 1000, "TimeStamp": "2018-03-01T10:00:03"}
+		]}`,
+	})
+	defer server.Close()
+
+	tickers := Get_tickers(map[string]bool{"LINK": true}, map[string]bool{"ETH": true, "BTC": true})
+
+	if len(tickers) != 2 {
+		t.Fatalf("expected LINK-ETH and LINK-BTC, got %v", tickers)
+	}
+
+	ticker := tickers["LINK-ETH"]
+
+	if ticker.Price != 0.0012 || ticker.Volume != 85.5 {
+		t.Errorf("LINK-ETH parsed as %+v", ticker)
+	}
+
+	if expected := time.Date(2018, 3, 1, 10, 0, 0, 5e8, time.UTC); !ticker.Timestamp.Equal(expected) {
+		t.Errorf("LINK-ETH timestamp is %s, expected %s", ticker.Timestamp, expected)
+	}
+
+	if tickers["LINK-BTC"].Price != 0.00009 {
+		t.Errorf("LINK-BTC parsed as %+v", tickers["LINK-BTC"])
+	}
+
+}
+
+func TestGet_order(t *testing.T) {
+
+	server, last := stand_in(t, map[string]string{
+		"/api/v1.1/account/getorder": `{"success": true, "result": {
+			"OrderUuid": "abc", "Quantity": 10, "QuantityRemaining": 4,
+			"PricePerUnit": 0.002, "CommissionPaid": 0.00003, "IsOpen": false
+		}}`,
+	})
+	defer server.Close()
+
+	order := Get_order("LINK-ETH", "sell", "abc")
+
+	if last.URL.Query().Get("uuid") != "abc" {
+		t.Errorf("order looked up as %s", last.URL.RawQuery)
+	}
+
+	if order.Open || order.Quantity != 6 || order.Price != 0.002 || order.Fee != 0.00003 {
+		t.Errorf("order parsed as %+v", order)
+	}
+
+	if !order.Done() {
+		t.Error("closed order with a fill should be done")
+	}
+
+}
+
+func TestTransfer(t *testing.T) {
+
+	server, last := stand_in(t, map[string]string{
+		"/api/v1.1/account/withdraw": `{"success": true, "result": {"uuid": "w-1"}}`,
+		"/api/v1.1/account/getwithdrawalhistory": `{"success": true, "result": [
+			{"PaymentUuid": "w-0", "Amount": 2, "Currency": "ETH", "TxId": "0xold"},
+			{"PaymentUuid": "w-1", "Amount": 1.5, "Currency": "ETH", "TxId": "0xABC"}
+		]}`,
+		"/api/v1.1/account/getdeposithistory": `{"success": true, "result": [
+			{"Id": 7, "Amount": 1.49, "Currency": "ETH", "TxId": "0xold", "LastUpdated": "2018-03-01T09:00:00"},
+			{"Id": 8, "Amount": 1.49, "Currency": "ETH", "TxId": "0xdef", "LastUpdated": "2018-03-01T11:00:00"},
+			{"Id": 9, "Amount": 1.49, "Currency": "ETH", "TxId": "abc", "LastUpdated": "2018-03-01T12:00:00"}
+		]}`,
+	})
+	defer server.Close()
+
+	withdrawal_id, started := Start_transfer("ETH", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", 1.5)
+
+	if !started || withdrawal_id != "w-1" {
+		t.Fatalf("withdrawal started as %q, %v", withdrawal_id, started)
+	}
+
+	if query := last.URL.Query(); query.Get("currency") != "ETH" || query.Get("address") != "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed" {
+		t.Errorf("withdrawal requested as %s", last.URL.RawQuery)
+	}
+
+	txid, found := Get_withdrawal_txid("ETH", withdrawal_id)
+
+	if !found || txid != "0xABC" {
+		t.Fatalf("withdrawal txid is %q, %v", txid, found)
+	}
+
+	since := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// same txid, ignoring case and the 0x prefix
+	if deposit_id, ok := Check_if_transferred("ETH", txid, 1.49, since, nil); !ok || deposit_id != "9" {
+		t.Errorf("matched on txid as %q, %v", deposit_id, ok)
+	}
+
+	// a deposit already matched elsewhere doesn't count twice
+	if _, ok := Check_if_transferred("ETH", txid, 1.49, since, map[string]bool{"9": true}); ok {
+		t.Error("matched a deposit that was already matched")
+	}
+
+	// with a known txid, amount alone never matches
+	if _, ok := Check_if_transferred("ETH", "0x123", 1.49, since, nil); ok {
+		t.Error("matched an unrelated txid on amount")
+	}
+
+	// without one, the first deposit of the amount since the transfer started
+	if deposit_id, ok := Check_if_transferred("ETH", "", 1.49, since, nil); !ok || deposit_id != "8" {
+		t.Errorf("matched on amount as %q, %v", deposit_id, ok)
+	}
+
+	// deposits from before the transfer started are never candidates
+	if _, ok := Check_if_transferred("ETH", "0xold", 1.49, since, nil); ok {
+		t.Error("matched a deposit from before the transfer started")
+	}
+
+}
+
+func TestCancel_order(t *testing.T) {
+
+	server, last := stand_in(t, map[string]string{
+		"/api/v1.1/market/cancel": `{"success": true, "message": "", "result": null}`,
+	})
+	defer server.Close()
+
+	if !Cancel_order("LINK-ETH", "sell", "abc") {
+		t.Error("cancel reported as refused")
+	}
+
+	if last.URL.Query().Get("uuid") != "abc" {
+		t.Errorf("cancel sent as %s", last.URL.RawQuery)
+	}
+
+	refused, _ := stand_in(t, map[string]string{
+		"/api/v1.1/market/cancel": `{"success": false, "message": "ORDER_NOT_OPEN", "result": null}`,
+	})
+	defer refused.Close()
+
+	if Cancel_order("LINK-ETH", "sell", "abc") {
+		t.Error("refused cancel reported as cancelled")
+	}
+
+}
+
+func TestCancel_expired(t *testing.T) {
+
+	server, last := stand_in(t, map[string]string{
+		"/api/v1.1/market/cancel": `{"success": true, "message": "", "result": null}`,
+		"/api/v1.1/account/getorder": `{"success": true, "result": {
+			"OrderUuid": "abc", "Quantity": 10, "QuantityRemaining": 6,
+			"PricePerUnit": 0.002, "CommissionPaid": 0.00002, "IsOpen": true
+		}}`,
+	})
+	defer server.Close()
+
+	// still open after the cancel, so it's left for the next run
+	order, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "abc")
+
+	if cancelled || !order.Open || order.Quantity != 4 {
+		t.Errorf("order still open after its cancel reported as %+v, %v", order, cancelled)
+	}
+
+	if last.URL.Path != "/api/v1.1/account/getorder" {
+		t.Errorf("cancel wasn't checked, last request was %s", last.URL.Path)
+	}
+
+}
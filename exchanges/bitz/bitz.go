@@ -6,8 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	// "reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,31 +21,66 @@ import (
 var api_url, api_key, api_secret, api_tradepw string
 var api_eth_fee float64
 
+type Place_order struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Id json.Number `json:"id"`
+	} `json:"data"`
+}
+
+type Cancel_request struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
 type Order struct {
-	Success bool `json:"success"`
-	Data    struct {
-		Id string `json:"orderOid"`
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Id         json.Number `json:"id"`
+		Price      float64     `json:"price,string"`
+		Number     float64     `json:"number,string"`
+		Numberover float64     `json:"numberover,string"`
+		Numberdeal float64     `json:"numberdeal,string"`
+		Fee        float64     `json:"fee,string"`
+		Status     int         `json:"status"`
 	} `json:"data"`
 }
 
-type Holdings struct {
-	Holding Holding `json:"data"`
-	Success bool    `json:"success"`
+type Transfer_request struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Id json.Number `json:"id"`
+	} `json:"data"`
 }
 
-type Holding struct {
-	Symbol string `json:"coinType"`
-	Amount string `json:"balanceStr,Number"`
+type Deposits struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data []struct {
+		Id     json.Number `json:"id"`
+		Coin   string      `json:"coin"`
+		Number float64     `json:"number,string"`
+		Txid   string      `json:"txid"`
+		Status int         `json:"status"`
+	} `json:"data"`
 }
 
-type Prices struct {
-	Prices  []Price `json:"data"`
-	Success bool    `json:"success"`
+// bitz returns balances keyed by lowercase coin
+// ex: {"eth": "1.5", "eth_lock": "0", "nuls": "100"}
+type Holdings struct {
+	Code int                    `json:"code"`
+	Data map[string]interface{} `json:"data"`
 }
 
-type Price struct {
-	Symbol string      `json:"symbol"`
-	Price  json.Number `json:"lastDealPrice,Number"`
+type Depth struct {
+	Code int `json:"code"`
+	Data struct {
+		Bids [][]interface{} `json:"bids"`
+		Asks [][]interface{} `json:"asks"`
+	} `json:"data"`
 }
 
 func Initialize(url, key, secret, tradepw, eth_fee string) {
@@ -60,157 +97,376 @@ func Initialize(url, key, secret, tradepw, eth_fee string) {
 
 func Get_balances(tokens map[string]bool) map[string]float64 {
 
+	var endpoint = "/api_v1/balances"
 	var holdings = make(map[string]float64)
-	// var body []byte
+	var params = sign_params(map[string]string{})
+	var data = new(Holdings)
+	var body []byte
 
-	// for token, _ := range tokens {
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
 
-	// 	var data = new(Holdings)
-	// 	var endpoint = "/v1/account/" + token + "/balance"
-	// 	var params = ""
+	err := json.Unmarshal(body, &data)
+	if err != nil || data.Code != 0 {
+		return holdings
+	}
 
-	// 	// perform api call
-	// 	body = execute("GET", api_url, endpoint, params)
+	// remove tokens that we don't care about
+	// locked balances come as separate "_lock" keys and are skipped
+	for coin, value := range data.Data {
 
-	// 	err := json.Unmarshal(body, &data)
-	// 	utils.Check(err)
+		token := strings.ToUpper(coin)
+
+		if !tokens[token] {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		utils.Check(err)
 
-	// 	holdings[data.Holding.Symbol] = data.Holding.Amount
+		holdings[token] = amount
 
-	// }
+	}
 
 	return holdings
 }
 
-func Get_price(tokens map[string]bool) map[string]float64 {
+func Get_price(tokens, quotes map[string]bool) map[string]float64 {
 
-	var params = ""
-	var endpoint = "/api_v1/tickerall"
-	var data interface{}
-	var prices = make(map[string]float64)
-	var body []byte
+	return utils.Ticker_prices(Get_tickers(tokens, quotes))
 
-	// perform api call
-	body = execute("GET", api_url, endpoint, params)
+}
 
-	err := json.Unmarshal(body, &data)
-	utils.Check(err)
+// bitz doesn't say when a market last traded
+func Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
 
-	all := data.(map[string]interface{})
-	allPrices := all["data"].(map[string]interface{})
+	var tickers = make(map[string]utils.Ticker)
+
+	allPrices, ok := get_tickerall()
+	if !ok {
+		return tickers
+	}
 
 	//parse data and format for return
 	for k, v := range allPrices {
 
 		// bitz formats pairs as "LINK_ETH"
-		// they also use token as key itself, which is the reason
-		// for parsing this data into a generic interface and not a struct
-		details := v.(map[string]interface{})
-		symbol := strings.ToUpper(k)
-		is_eth_pair := strings.HasSuffix(symbol, "_ETH")
-		token := strings.TrimSuffix(symbol, "_ETH")
-		// TODO: throws error fmt.Println(details, reflect.TypeOf(details["last"]))
-		price, err := strconv.ParseFloat(details["last"].(string), 64)
-		utils.Check(err)
+		pair, ok := utils.Symbol_pair(k, "_", false, quotes)
+
+		if !ok || !tokens[utils.Pair_token(pair)] {
+			continue
+		}
+
+		details, ok := v.(map[string]interface{})
+		last, has_last := details["last"].(string)
+		vol, has_vol := details["vol"].(string)
+		if !ok || !has_last || !has_vol {
+			utils.Api_schema_error("bitz", fmt.Errorf("no last price or volume for %s", k))
+			continue
+		}
+
+		price, err := strconv.ParseFloat(last, 64)
+		if utils.Api_schema_error("bitz", err) {
+			continue
+		}
 
-		if is_eth_pair && tokens[token] {
-			prices[token+"-ETH"] = price
+		// volume is in the token
+		volume, err := strconv.ParseFloat(vol, 64)
+		if utils.Api_schema_error("bitz", err) {
+			continue
 		}
+
+		tickers[pair] = utils.Ticker{Price: price, Volume: volume * price}
 	}
 
-	return prices
+	return tickers
 }
 
-func Get_listed_tokens() []string {
+func Get_order_book(pair string) utils.Order_book {
 
-	var params = ""
-	var endpoint = "/api_v1/tickerall"
-	var data interface{}
-	var tokens []string
+	var params = "coin=" + coin(pair)
+	var endpoint = "/api_v1/depth"
+	var data = new(Depth)
 	var body []byte
 
 	// perform api call
 	body = execute("GET", api_url, endpoint, params)
 
 	err := json.Unmarshal(body, &data)
-	utils.Check(err)
+	if err != nil || data.Code != 0 {
+		return utils.Order_book{}
+	}
+
+	// bitz sends asks highest first, sorting takes care of it
+	return utils.Sort_order_book(utils.Order_book{
+		Bids: utils.Parse_levels(data.Data.Bids),
+		Asks: utils.Parse_levels(data.Data.Asks),
+	})
+
+}
 
-	all := data.(map[string]interface{})
-	allPrices := all["data"].(map[string]interface{})
+func Get_listed_tokens(quotes map[string]bool) []string {
+
+	var tokens []string
+
+	allPrices, ok := get_tickerall()
+	if !ok {
+		return tokens
+	}
 
 	//parse data and format for return
 	for k, _ := range allPrices {
 
 		// bitz formats pairs as "link_eth"
-		// they also use token as key itself, which is the reason
-		// for parsing this data into a generic interface and not a struct
-		symbol := strings.ToUpper(k)
-		is_eth_pair := strings.HasSuffix(symbol, "_ETH")
-		token := strings.TrimSuffix(symbol, "_ETH")
-
-		if is_eth_pair {
-			tokens = append(tokens, token)
+		pair, ok := utils.Symbol_pair(k, "_", false, quotes)
+
+		if ok && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
 		}
 	}
 
 	return tokens
 }
 
-func Place_sell_order(token string, quantity int, price float64) (transaction_id string, sell_placed bool) {
+// bitz uses the pair as the key itself, which is the reason
+// for parsing tickers into a generic interface and not a struct
+// ex: {"code": 0, "data": {"link_eth": {"last": "0.0012", ...}}}
+func get_tickerall() (map[string]interface{}, bool) {
+
+	var params = ""
+	var endpoint = "/api_v1/tickerall"
+	var data interface{}
+	var body []byte
+
+	// perform api call
+	body = execute("GET", api_url, endpoint, params)
+
+	err := json.Unmarshal(body, &data)
+	if utils.Api_schema_error("bitz", err) {
+		return nil, false
+	}
+
+	all, ok := data.(map[string]interface{})
+	if !ok {
+		utils.Api_schema_error("bitz", fmt.Errorf("tickerall is %T, not an object", data))
+		return nil, false
+	}
+
+	allPrices, ok := all["data"].(map[string]interface{})
+	if !ok {
+		utils.Api_schema_error("bitz", fmt.Errorf("tickerall data is %T, not an object", all["data"]))
+		return nil, false
+	}
+
+	return allPrices, true
+
+}
+
+func Place_sell_order(pair string, quantity, price float64) (transaction_id string, sell_placed bool) {
 
-	token += "_ETH"
-	var timestamp = strconv.Itoa(int(time.Now().Unix() * 1000))
-	var params = fmt.Sprintf("api_key=%s&coin=%s&nonce=235195&number=%d&price=%f&timestamp=%d&tradepwd=%s&type=out&sign=%s",
-		api_key, token, quantity, price, timestamp, api_tradepw)
-	var signature = make_signature(params)
 	var endpoint = "/api_v1/tradeAdd"
-	var order = new(Order)
+	var params = sign_params(map[string]string{
+		"coin":     coin(pair),
+		"number":   fmt.Sprintf("%f", quantity),
+		"price":    fmt.Sprintf("%f", price),
+		"tradepwd": api_tradepw,
+		"type":     "out",
+	})
+	var place_order = new(Place_order)
 	var body []byte
 
-	params = params + "&sign=" + signature
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
+
+	err := json.Unmarshal(body, &place_order)
+	utils.Check(err)
+
+	if place_order.Code != 0 || place_order.Data.Id == "" {
+		return "", false
+	}
+
+	return place_order.Data.Id.String(), true
+
+}
+
+func Get_order(pair, side, order_id string) utils.Order_status {
+
+	order := get_order(pair, order_id)
+
+	// bitz status 0 is unfilled and 1 partially filled
+	// 2 is a fully filled order and 3 a cancelled one
+	return utils.Order_status{
+		Open:     order.Code != 0 || order.Data.Status < 2,
+		Quantity: order.Data.Numberdeal,
+		Price:    order.Data.Price,
+		Fee:      order.Data.Fee,
+	}
+
+}
+
+func Start_transfer(asset, destination string, amount float64) (string, bool) {
+
+	var endpoint = "/api_v1/withdraw"
+	var params = sign_params(map[string]string{
+		"address":  destination,
+		"coin":     strings.ToLower(asset),
+		"number":   fmt.Sprintf("%f", amount),
+		"tradepwd": api_tradepw,
+	})
+	var transfer = new(Transfer_request)
+	var body []byte
 
 	// perform api call
 	body = execute("POST", api_url, endpoint, params)
 
-	err := json.Unmarshal(body, &order)
+	err := json.Unmarshal(body, &transfer)
 	utils.Check(err)
 
-	if order.Data.Id == "" {
+	if transfer.Code != 0 {
 		return "", false
 	}
 
-	return order.Data.Id, true
+	return transfer.Data.Id.String(), true
 
 }
 
-func Check_if_sold(token, sell_tx_id string) (float64, bool) {
+// bitz has no withdrawal history to look the txid up in
+func Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
 
-	var amount = 0.0
-	return amount, true
+	return "", false
 
 }
 
-func Start_transfer(token, destination string, amount float64) (string, bool) {
+// bitz deposits don't say when they landed
+// so they're only matched on the txid
+func Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+
+	var endpoint = "/api_v1/depositList"
+	var params = sign_params(map[string]string{
+		"coin": strings.ToLower(asset),
+	})
+	var deposits = new(Deposits)
+	var list []utils.Deposit
+	var body []byte
+
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
+
+	err := json.Unmarshal(body, &deposits)
+	utils.Check(err)
+
+	// bitz status 1 is a credited deposit
+	for _, d := range deposits.Data {
+		if d.Status == 1 {
+			list = append(list, utils.Deposit{Id: d.Id.String(), Txid: d.Txid, Amount: d.Number})
+		}
+	}
 
-	return "", true
+	return utils.Match_deposit(list, txid, amount, since, matched)
 
 }
 
-func Check_if_transferred(sell_cost float64) bool {
+func Place_buy_order(pair string, quantity, price float64) (string, bool) {
+
+	var endpoint = "/api_v1/tradeAdd"
+	var params = sign_params(map[string]string{
+		"coin":     coin(pair),
+		"number":   fmt.Sprintf("%f", quantity),
+		"price":    fmt.Sprintf("%f", price),
+		"tradepwd": api_tradepw,
+		"type":     "in",
+	})
+	var place_order = new(Place_order)
+	var body []byte
+
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
+
+	err := json.Unmarshal(body, &place_order)
+	utils.Check(err)
+
+	if place_order.Code != 0 || place_order.Data.Id == "" {
+		return "", false
+	}
 
-	return true
+	return place_order.Data.Id.String(), true
 
 }
 
-func Place_buy_order(token string, quantity, buy_cost float64) (string, bool) {
+func Cancel_order(pair, side, order_id string) bool {
 
-	return "", true
+	var endpoint = "/api_v1/tradeCancel"
+	var params = sign_params(map[string]string{
+		"coin": coin(pair),
+		"id":   order_id,
+	})
+	var cancel_order = new(Cancel_request)
+	var body []byte
+
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
+
+	err := json.Unmarshal(body, &cancel_order)
+	utils.Check(err)
+
+	return cancel_order.Code == 0
 
 }
 
-func Check_if_bought(token, buy_tx_id string) bool {
+func get_order(pair, order_id string) *Order {
 
-	return true
+	var endpoint = "/api_v1/orderView"
+	var params = sign_params(map[string]string{
+		"coin": coin(pair),
+		"id":   order_id,
+	})
+	var order = new(Order)
+	var body []byte
+
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
+
+	// leave the order as not found on bad responses
+	// so that the transaction isn't moved along
+	err := json.Unmarshal(body, &order)
+	if err != nil {
+		order.Code = -1
+	}
+
+	return order
+
+}
+
+// bitz names markets in lowercase, ie "link_eth"
+func coin(pair string) string {
+	return strings.ToLower(utils.Pair_symbol(pair, "_", false))
+}
+
+// bitz expects every signed call to carry key, timestamp and nonce
+// all parameters sorted alphabetically, then md5 of that string
+// with the secret appended is passed along as "sign"
+func sign_params(params map[string]string) string {
+
+	var keys []string
+	var pairs []string
+
+	params["api_key"] = api_key
+	params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
+	params["nonce"] = fmt.Sprintf("%06d", rand.Intn(1000000))
+
+	for k := range params {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+params[k])
+	}
+
+	query := strings.Join(pairs, "&")
+
+	return query + "&sign=" + make_signature(query+api_secret)
 
 }
 
@@ -229,11 +485,26 @@ func execute(method string, url string, endpoint string, params string) []byte {
 
 	req.Header.Add("Accept", "application/json")
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: utils.Request_timeout}
+
+	utils.Wait_turn("bitz")
 
+	started := time.Now()
 	res, err := client.Do(req)
 	utils.Check(err)
 
+	status := 0
+
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	utils.Api_call("bitz", started, status, err)
+
+	if res == nil {
+		return nil
+	}
+
 	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
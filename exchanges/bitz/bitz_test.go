@@ -0,0 +1,103 @@
+package bitz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	// common exchange interface and registry
+	"../../exchanges"
+)
+
+// stands in for bitz's order endpoints, the order stays partially
+// filled until it's cancelled, at 4 of 10
+// refusing answers cancels the way bitz does for unknown orders
+func stand_in(t *testing.T, refuse bool) (*httptest.Server, *url.Values) {
+
+	cancelled := false
+	cancel := new(url.Values)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+
+		// the signature covers the sorted params before it
+		signed := strings.Split(r.URL.RawQuery, "&sign=")[0]
+
+		if query.Get("api_key") != "key" || query.Get("nonce") == "" || query.Get("sign") != make_signature(signed+"secret") {
+			t.Errorf("%s %s sent without key, nonce or a valid signature", r.Method, r.URL.Path)
+		}
+
+		switch r.Method + " " + r.URL.Path {
+
+		case "POST /api_v1/tradeCancel":
+			*cancel = query
+
+			if refuse {
+				w.Write([]byte(`{"code": 31004, "msg": "order not found"}`))
+				return
+			}
+
+			cancelled = true
+			w.Write([]byte(`{"code": 0, "msg": "", "data": null}`))
+
+		case "POST /api_v1/orderView":
+			if cancelled {
+				w.Write([]byte(`{"code": 0, "msg": "", "data": {"id": "42", "price": "0.002", "number": "10", "numberover": "6", "numberdeal": "4", "fee": "0.000008", "status": 3}}`))
+			} else {
+				w.Write([]byte(`{"code": 0, "msg": "", "data": {"id": "42", "price": "0.002", "number": "10", "numberover": "6", "numberdeal": "4", "fee": "0.000008", "status": 1}}`))
+			}
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+
+		}
+
+	}))
+
+	api_url = server.URL
+	api_key = "key"
+	api_secret = "secret"
+
+	return server, cancel
+
+}
+
+func TestCancel_order(t *testing.T) {
+
+	server, cancel := stand_in(t, false)
+	defer server.Close()
+
+	if order := Get_order("LINK-ETH", "sell", "42"); !order.Open || order.Quantity != 4 {
+		t.Errorf("partially filled order parsed as %+v", order)
+	}
+
+	order, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "42")
+
+	if cancel.Get("id") != "42" || cancel.Get("coin") != "link_eth" {
+		t.Errorf("cancel sent as %v", *cancel)
+	}
+
+	if !cancelled || !order.Done() || order.Quantity != 4 || order.Price != 0.002 || order.Fee != 0.000008 {
+		t.Errorf("cancelled order reported as %+v, %v", order, cancelled)
+	}
+
+}
+
+func TestCancel_order_refused(t *testing.T) {
+
+	server, _ := stand_in(t, true)
+	defer server.Close()
+
+	if Cancel_order("LINK-ETH", "sell", "42") {
+		t.Error("refused cancel reported as cancelled")
+	}
+
+	if _, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "42"); cancelled {
+		t.Error("order still open after a refused cancel reported as cancelled")
+	}
+
+}
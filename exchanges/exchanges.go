@@ -0,0 +1,98 @@
+package exchanges
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	// utility
+	"../utils"
+)
+
+// every exchange package exposes the same set of functions
+// this interface lets main.go treat them interchangeably
+// instead of switching over exchange names at every step
+// markets are passed around as pairs, ie "LINK-ETH" or "LINK-BTC"
+type Exchange interface {
+	Get_price(tokens, quotes map[string]bool) map[string]float64
+	Get_order_book(pair string) utils.Order_book
+	Get_balances(tokens map[string]bool) map[string]float64
+	Get_listed_tokens(quotes map[string]bool) []string
+	Place_sell_order(pair string, quantity, price float64) (string, bool)
+	Start_transfer(asset, destination string, amount float64) (string, bool)
+	Get_withdrawal_txid(asset, withdrawal_id string) (string, bool)
+	Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool)
+	Place_buy_order(pair string, quantity, price float64) (string, bool)
+	Get_order(pair, side, order_id string) utils.Order_status
+	Cancel_order(pair, side, order_id string) bool
+}
+
+// some exchanges, like OKEX, have no convenient way of listing
+// all of their tokens, so they look up the ones found elsewhere
+type Searcher interface {
+	Search_listed_tokens(search []string, quotes map[string]bool) []string
+}
+
+// most exchanges report 24h volume along with their prices
+// and some when the market last traded, which lets stale
+// and thin markets be left out of comparisons
+type Ticker interface {
+	Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker
+}
+
+// exchanges enabled through .env, keyed by lowercase name
+// ex: ["binance"] = binance.Adapter{}
+var registry = make(map[string]Exchange)
+
+func Register(name string, exchange Exchange) {
+
+	fmt.Println("registering " + name + " exchange")
+
+	registry[name] = exchange
+
+}
+
+func Get(name string) (Exchange, bool) {
+
+	exchange, ok := registry[name]
+	return exchange, ok
+
+}
+
+// names of all registered exchanges, sorted
+// so that every run iterates them in the same order
+func Names() []string {
+
+	var names []string
+
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+
+}
+
+// cancels an order left unfilled for too long and returns it as
+// last reported, false while it still shows as open, either because
+// the cancel failed or because cancels take a moment to show up
+// an order that filled in the meantime comes back done
+func Cancel_expired(exchange Exchange, pair, side, order_id string) (utils.Order_status, bool) {
+
+	order := exchange.Get_order(pair, side, order_id)
+
+	if order.Open {
+
+		if !exchange.Cancel_order(pair, side, order_id) {
+			return order, false
+		}
+
+		order = exchange.Get_order(pair, side, order_id)
+
+	}
+
+	return order, !order.Open
+
+}
@@ -0,0 +1,116 @@
+package exchanges
+
+import (
+	"testing"
+	"time"
+
+	// utility
+	"../utils"
+)
+
+// stands in for an exchange, answering Get_order from a script
+// of statuses, one per call, and counting cancels
+type mock struct {
+	orders  []utils.Order_status
+	cancels int
+	refuse  bool
+}
+
+func (m *mock) Get_order(pair, side, order_id string) utils.Order_status {
+
+	order := m.orders[0]
+
+	if len(m.orders) > 1 {
+		m.orders = m.orders[1:]
+	}
+
+	return order
+
+}
+
+func (m *mock) Cancel_order(pair, side, order_id string) bool {
+
+	m.cancels++
+
+	return !m.refuse
+
+}
+
+func (m *mock) Get_price(tokens, quotes map[string]bool) map[string]float64 { return nil }
+func (m *mock) Get_order_book(pair string) utils.Order_book                 { return utils.Order_book{} }
+func (m *mock) Get_balances(tokens map[string]bool) map[string]float64      { return nil }
+func (m *mock) Get_listed_tokens(quotes map[string]bool) []string           { return nil }
+func (m *mock) Place_sell_order(pair string, quantity, price float64) (string, bool) {
+	return "", false
+}
+func (m *mock) Place_buy_order(pair string, quantity, price float64) (string, bool) {
+	return "", false
+}
+func (m *mock) Start_transfer(asset, destination string, amount float64) (string, bool) {
+	return "", false
+}
+func (m *mock) Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) { return "", false }
+func (m *mock) Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+	return "", false
+}
+
+func TestCancel_expired(t *testing.T) {
+
+	open := utils.Order_status{Open: true}
+	partial := utils.Order_status{Open: true, Quantity: 4, Price: 0.002}
+
+	cases := []struct {
+		name      string
+		exchange  *mock
+		cancels   int
+		cancelled bool
+		expected  utils.Order_status
+	}{
+		{
+			name:      "unfilled order is cancelled",
+			exchange:  &mock{orders: []utils.Order_status{open, {}}},
+			cancels:   1,
+			cancelled: true,
+			expected:  utils.Order_status{},
+		},
+		{
+			name:      "part filled before the cancel is kept",
+			exchange:  &mock{orders: []utils.Order_status{partial, {Quantity: 4, Price: 0.002, Fee: 0.00001}}},
+			cancels:   1,
+			cancelled: true,
+			expected:  utils.Order_status{Quantity: 4, Price: 0.002, Fee: 0.00001},
+		},
+		{
+			name:      "filled in the meantime isn't cancelled",
+			exchange:  &mock{orders: []utils.Order_status{{Quantity: 10, Price: 0.002}}},
+			cancels:   0,
+			cancelled: true,
+			expected:  utils.Order_status{Quantity: 10, Price: 0.002},
+		},
+		{
+			name:      "refused cancel is retried later",
+			exchange:  &mock{orders: []utils.Order_status{open}, refuse: true},
+			cancels:   1,
+			cancelled: false,
+			expected:  open,
+		},
+		{
+			name:      "cancel that hasn't shown up yet is retried later",
+			exchange:  &mock{orders: []utils.Order_status{open, open}},
+			cancels:   1,
+			cancelled: false,
+			expected:  open,
+		},
+	}
+
+	for _, c := range cases {
+
+		order, cancelled := Cancel_expired(c.exchange, "LINK-ETH", "sell", "abc")
+
+		if cancelled != c.cancelled || order != c.expected || c.exchange.cancels != c.cancels {
+			t.Errorf("%s: got %+v, %v after %d cancels", c.name, order, cancelled, c.exchange.cancels)
+		}
+
+	}
+
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	// utility
@@ -38,8 +39,10 @@ type Deposits struct {
 			Status   string  `json:"status"`
 			Address  string  `json:"address"`
 			Context  string  `json:"context"`
+			Txid     string  `json:"outerWalletTxid"`
 			UserOid  string  `json:"userOid"`
 			CoinType string  `json:"coinType"`
+			Created  int64   `json:"createdAt"`
 		} `json:"datas"`
 	} `json:"data"`
 }
@@ -51,6 +54,12 @@ type Place_order struct {
 	} `json:"data"`
 }
 
+type Cancel_request struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Msg     string `json:"msg"`
+}
+
 type Order struct {
 	Success bool `json:"success"`
 	Data    struct {
@@ -60,6 +69,7 @@ type Order struct {
 		DealAmount       float64 `json:"dealAmount,Number"`
 		OrderPrice       float64 `json:"orderPrice,Number"`
 		PendingAmount    float64 `json:"pendingAmount,Number"`
+		IsActive         bool    `json:"isActive"`
 	} `json:"data"`
 }
 
@@ -79,8 +89,18 @@ type Prices struct {
 }
 
 type Price struct {
-	Symbol string      `json:"symbol"`
-	Price  json.Number `json:"lastDealPrice,Number"`
+	Symbol   string      `json:"symbol"`
+	Price    json.Number `json:"lastDealPrice,Number"`
+	Volume   json.Number `json:"volValue,Number"`
+	Datetime int64       `json:"datetime"`
+}
+
+type Depth struct {
+	Success bool `json:"success"`
+	Data    struct {
+		Sell [][]interface{} `json:"SELL"`
+		Buy  [][]interface{} `json:"BUY"`
+	} `json:"data"`
 }
 
 func Initialize(url, key, secret, eth_fee string) {
@@ -97,45 +117,57 @@ func Initialize(url, key, secret, eth_fee string) {
 func Get_balances(tokens map[string]bool) map[string]float64 {
 
 	var holdings = make(map[string]float64)
-	var body []byte
+	var symbols []string
+	var mutex sync.Mutex
 
 	for token, _ := range tokens {
+		symbols = append(symbols, token)
+	}
+
+	// one api call per token
+	utils.Parallel(symbols, func(token string) {
 
 		var data = new(Holdings)
 		var endpoint = "/v1/account/" + token + "/balance"
 		var params = ""
 
 		// perform api call
-		body = execute("GET", api_url, endpoint, params, true)
+		body := execute("GET", api_url, endpoint, params, true)
 
 		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return holdings
+		if err != nil || !data.Success {
+			return
 		}
 
-		if data.Success {
-			holdings[data.Holding.Symbol] = data.Holding.Amount
-		}
+		mutex.Lock()
+		holdings[data.Holding.Symbol] = data.Holding.Amount
+		mutex.Unlock()
 
-	}
+	})
 
 	return holdings
 }
 
-func Get_price(tokens map[string]bool) map[string]float64 {
+func Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	return utils.Ticker_prices(Get_tickers(tokens, quotes))
+
+}
+
+func Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
 
 	var params = ""
 	var endpoint = "/v1/open/tick"
 	var data = new(Prices)
-	var prices = make(map[string]float64)
+	var tickers = make(map[string]utils.Ticker)
 	var body []byte
 
 	// perform api call
 	body = execute("GET", api_url, endpoint, params, false)
 
 	err := json.Unmarshal(body, &data)
-	if err != nil {
-		return prices
+	if utils.Api_schema_error("kucoin", err) {
+		return tickers
 	}
 
 	//parse data and format for return
@@ -143,24 +175,54 @@ func Get_price(tokens map[string]bool) map[string]float64 {
 
 		// kucoin formats pairs as "LINK-ETH"
 		// this will be the format we convert others to
-		symbol := v.Symbol
-		is_eth_pair := strings.HasSuffix(symbol, "-ETH")
-		token := strings.TrimSuffix(symbol, "-ETH")
+		pair, ok := utils.Symbol_pair(v.Symbol, "-", false, quotes)
+
+		if v.Price != "" && ok && tokens[utils.Pair_token(pair)] {
 
-		if v.Price != "" {
 			price, err := strconv.ParseFloat(string(v.Price), 64)
 			utils.Check(err)
 
-			if is_eth_pair && tokens[token] {
-				prices[token+"-ETH"] = price
+			// volume value is in the quote
+			volume, _ := strconv.ParseFloat(string(v.Volume), 64)
+
+			ticker := utils.Ticker{Price: price, Volume: volume}
+
+			if v.Datetime > 0 {
+				ticker.Timestamp = time.Unix(0, v.Datetime*int64(time.Millisecond))
 			}
+
+			tickers[pair] = ticker
+
 		}
 	}
 
-	return prices
+	return tickers
+}
+
+func Get_order_book(pair string) utils.Order_book {
+
+	var params = fmt.Sprintf("limit=%d&symbol=%s", 20, pair)
+	var endpoint = "/v1/open/orders"
+	var data = new(Depth)
+	var body []byte
+
+	// perform api call
+	body = execute("GET", api_url, endpoint, params, false)
+
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return utils.Order_book{}
+	}
+
+	// kucoin levels are [price, amount, volume]
+	return utils.Sort_order_book(utils.Order_book{
+		Bids: utils.Parse_levels(data.Data.Buy),
+		Asks: utils.Parse_levels(data.Data.Sell),
+	})
+
 }
 
-func Get_listed_tokens() []string {
+func Get_listed_tokens(quotes map[string]bool) []string {
 
 	var params = ""
 	var endpoint = "/v1/open/tick"
@@ -180,23 +242,20 @@ func Get_listed_tokens() []string {
 	for _, v := range data.Prices {
 
 		// kucoin formats pairs as "LINK-ETH"
-		// this will be the format we convert others to
-		symbol := v.Symbol
-		is_eth_pair := strings.HasSuffix(symbol, "-ETH")
-		token := strings.TrimSuffix(symbol, "-ETH")
+		// a token listed on several quotes is only counted once
+		pair, ok := utils.Symbol_pair(v.Symbol, "-", false, quotes)
 
-		if is_eth_pair {
-			tokens = append(tokens, token)
+		if ok && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
 		}
 	}
 
 	return tokens
 }
 
-func Place_sell_order(token string, quantity int, price float64) (transaction_id string, sell_placed bool) {
+func Place_sell_order(pair string, quantity, price float64) (transaction_id string, sell_placed bool) {
 
-	token += "-ETH"
-	var params = fmt.Sprintf("amount=%d&price=%f&symbol=%s&type=%s", quantity, price, token, "SELL")
+	var params = fmt.Sprintf("amount=%f&price=%f&symbol=%s&type=%s", quantity, price, pair, "SELL")
 	var endpoint = "/v1/order"
 	var place_order = new(Place_order)
 	var body []byte
@@ -215,10 +274,9 @@ func Place_sell_order(token string, quantity int, price float64) (transaction_id
 
 }
 
-func Check_if_sold(token, sell_tx_id string) (float64, bool) {
+func Get_order(pair, side, order_id string) utils.Order_status {
 
-	token += "-ETH"
-	var params = fmt.Sprintf("limit=%d&orderOid=%s&page=%d&symbol=%s&type=%s", 5, sell_tx_id, 1, token, "SELL")
+	var params = fmt.Sprintf("limit=%d&orderOid=%s&page=%d&symbol=%s&type=%s", 5, order_id, 1, pair, strings.ToUpper(side))
 	var endpoint = "/v1/order/detail"
 	var order = new(Order)
 	var body []byte
@@ -229,18 +287,19 @@ func Check_if_sold(token, sell_tx_id string) (float64, bool) {
 	err := json.Unmarshal(body, &order)
 	utils.Check(err)
 
-	if order.Data.PendingAmount == 0 {
-		return order.Data.DealValueTotal, true
+	return utils.Order_status{
+		Open:     !order.Success || order.Data.IsActive,
+		Quantity: order.Data.DealAmount,
+		Price:    order.Data.DealPriceAverage,
+		Fee:      order.Data.FeeTotal,
 	}
 
-	return 0.0, false
-
 }
 
-func Start_transfer(token, destination string, amount float64) (string, bool) {
+func Start_transfer(asset, destination string, amount float64) (string, bool) {
 
-	var params = fmt.Sprintf("address=%s&amount=%f&coin=%s", destination, amount, token)
-	var endpoint = "/v1/account/" + token + "/withdraw/apply"
+	var params = fmt.Sprintf("address=%s&amount=%f&coin=%s", destination, amount, asset)
+	var endpoint = "/v1/account/" + asset + "/withdraw/apply"
 	var transfer = new(Transfer_request)
 	var body []byte
 
@@ -250,19 +309,49 @@ func Start_transfer(token, destination string, amount float64) (string, bool) {
 	err := json.Unmarshal(body, &transfer)
 	utils.Check(err)
 
+	// data is the oid of the withdrawal record
 	if transfer.Success {
-		return "", true
+		return transfer.Data, true
 	}
 
 	return "", false
 
 }
 
-func Check_if_transferred(sell_cost float64) bool {
+func Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
+
+	var params = fmt.Sprintf("limit=%d&page=%d&type=%s", 10, 1, "WITHDRAW")
+	var endpoint = "/v1/account/" + asset + "/wallet/records"
+	var withdrawals = new(Deposits)
+	var body []byte
+
+	// transfers from before withdrawal ids were kept
+	if withdrawal_id == "" {
+		return "", false
+	}
+
+	// perform api call
+	body = execute("GET", api_url, endpoint, params, true)
+
+	err := json.Unmarshal(body, &withdrawals)
+	utils.Check(err)
+
+	for _, w := range withdrawals.Data.List {
+		if w.Oid == withdrawal_id && w.Txid != "" {
+			return w.Txid, true
+		}
+	}
+
+	return "", false
+
+}
+
+func Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
 
 	var params = fmt.Sprintf("limit=%d&page=%d&type=%s", 10, 1, "DEPOSIT")
-	var endpoint = "/v1/account/ETH/wallet/records"
+	var endpoint = "/v1/account/" + asset + "/wallet/records"
 	var deposits = new(Deposits)
+	var list []utils.Deposit
 	var body []byte
 
 	// perform api call
@@ -272,19 +361,27 @@ func Check_if_transferred(sell_cost float64) bool {
 	utils.Check(err)
 
 	for _, deposit := range deposits.Data.List {
-		if deposit.Amount == sell_cost && deposit.Status == "SUCCESS" {
-			return true
+
+		if deposit.Status != "SUCCESS" {
+			continue
 		}
+
+		list = append(list, utils.Deposit{
+			Id:        deposit.Oid,
+			Txid:      deposit.Txid,
+			Amount:    deposit.Amount,
+			Timestamp: time.Unix(0, deposit.Created*int64(time.Millisecond)),
+		})
+
 	}
 
-	return false
+	return utils.Match_deposit(list, txid, amount, since, matched)
 
 }
 
-func Place_buy_order(token string, amount, price float64) (string, bool) {
+func Place_buy_order(pair string, amount, price float64) (string, bool) {
 
-	token += "-ETH"
-	var params = fmt.Sprintf("amount=%f&price=%f&symbol=%s&type=%s", amount, price, token, "BUY")
+	var params = fmt.Sprintf("amount=%f&price=%f&symbol=%s&type=%s", amount, price, pair, "BUY")
 	var endpoint = "/v1/order"
 	var place_order = new(Place_order)
 	var body []byte
@@ -303,25 +400,20 @@ func Place_buy_order(token string, amount, price float64) (string, bool) {
 
 }
 
-func Check_if_bought(token, buy_tx_id string) bool {
+func Cancel_order(pair, side, order_id string) bool {
 
-	token += "-ETH"
-	var params = fmt.Sprintf("limit=%d&orderOid=%s&page=%d&symbol=%s&type=%s", 5, buy_tx_id, 1, token, "BUY")
-	var endpoint = "/v1/order/detail"
-	var order = new(Order)
+	var params = fmt.Sprintf("orderOid=%s&symbol=%s&type=%s", order_id, pair, strings.ToUpper(side))
+	var endpoint = "/v1/cancel-order"
+	var cancel_order = new(Cancel_request)
 	var body []byte
 
 	// perform api call
-	body = execute("GET", api_url, endpoint, params, true)
+	body = execute("POST", api_url, endpoint, params, true)
 
-	err := json.Unmarshal(body, &order)
+	err := json.Unmarshal(body, &cancel_order)
 	utils.Check(err)
 
-	if order.Data.PendingAmount == 0 {
-		return true
-	}
-
-	return false
+	return cancel_order.Success
 
 }
 
@@ -355,11 +447,26 @@ func execute(method string, url string, endpoint string, params string, auth boo
 
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: utils.Request_timeout}
+
+	utils.Wait_turn("kucoin")
 
+	started := time.Now()
 	res, err := client.Do(req)
 	utils.Check(err)
 
+	status := 0
+
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	utils.Api_call("kucoin", started, status, err)
+
+	if res == nil {
+		return nil
+	}
+
 	defer res.Body.Close()
 
 	body, err := ioutil.ReadAll(res.Body)
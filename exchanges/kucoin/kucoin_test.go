@@ -0,0 +1,99 @@
+package kucoin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	// common exchange interface and registry
+	"../../exchanges"
+)
+
+// stands in for kucoin's order endpoints, the order stays active
+// until it's cancelled, having filled 4 of 10 by then
+// refusing answers cancels the way kucoin does for unknown orders
+func stand_in(t *testing.T, refuse bool) (*httptest.Server, *url.Values) {
+
+	cancelled := false
+	cancel := new(url.Values)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+
+		if r.Header.Get("KC-API-KEY") != "key" || r.Header.Get("KC-API-NONCE") == "" || r.Header.Get("KC-API-SIGNATURE") == "" {
+			t.Errorf("%s %s sent unsigned", r.Method, r.URL.Path)
+		}
+
+		switch r.Method + " " + r.URL.Path {
+
+		case "POST /v1/cancel-order":
+			*cancel = query
+
+			if refuse {
+				w.Write([]byte(`{"success": false, "code": "NO_ORDER", "msg": "Order not found"}`))
+				return
+			}
+
+			cancelled = true
+			w.Write([]byte(`{"success": true, "code": "OK", "msg": "Operation succeeded."}`))
+
+		case "GET /v1/order/detail":
+			if cancelled {
+				w.Write([]byte(`{"success": true, "data": {"dealValueTotal": 0.008, "dealPriceAverage": 0.002, "feeTotal": 0.000008, "dealAmount": 4, "orderPrice": 0.002, "pendingAmount": 0, "isActive": false}}`))
+			} else {
+				w.Write([]byte(`{"success": true, "data": {"dealValueTotal": 0.008, "dealPriceAverage": 0.002, "feeTotal": 0.000008, "dealAmount": 4, "orderPrice": 0.002, "pendingAmount": 6, "isActive": true}}`))
+			}
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+
+		}
+
+	}))
+
+	api_url = server.URL
+	api_key = "key"
+	api_secret = "secret"
+
+	return server, cancel
+
+}
+
+func TestCancel_order(t *testing.T) {
+
+	server, cancel := stand_in(t, false)
+	defer server.Close()
+
+	if order := Get_order("LINK-ETH", "sell", "5a8f"); !order.Open || order.Quantity != 4 {
+		t.Errorf("partially filled order parsed as %+v", order)
+	}
+
+	order, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "5a8f")
+
+	if cancel.Get("orderOid") != "5a8f" || cancel.Get("symbol") != "LINK-ETH" || cancel.Get("type") != "SELL" {
+		t.Errorf("cancel sent as %v", *cancel)
+	}
+
+	if !cancelled || !order.Done() || order.Quantity != 4 || order.Price != 0.002 || order.Fee != 0.000008 {
+		t.Errorf("cancelled order reported as %+v, %v", order, cancelled)
+	}
+
+}
+
+func TestCancel_order_refused(t *testing.T) {
+
+	server, _ := stand_in(t, true)
+	defer server.Close()
+
+	if Cancel_order("LINK-ETH", "sell", "5a8f") {
+		t.Error("refused cancel reported as cancelled")
+	}
+
+	if _, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "sell", "5a8f"); cancelled {
+		t.Error("order still active after a refused cancel reported as cancelled")
+	}
+
+}
@@ -0,0 +1,66 @@
+package okex
+
+import (
+	"time"
+
+	// utility
+	"../../utils"
+)
+
+// satisfies exchanges.Exchange by forwarding
+// every call to the package level functions
+type Adapter struct{}
+
+func (Adapter) Get_price(tokens, quotes map[string]bool) map[string]float64 {
+	return Get_price(tokens, quotes)
+}
+
+func (Adapter) Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
+	return Get_tickers(tokens, quotes)
+}
+
+func (Adapter) Get_order_book(pair string) utils.Order_book {
+	return Get_order_book(pair)
+}
+
+func (Adapter) Get_balances(tokens map[string]bool) map[string]float64 {
+	return Get_balances(tokens)
+}
+
+// OKEX has no convenient way of getting a list of all listed tokens
+// see Search_listed_tokens below
+func (Adapter) Get_listed_tokens(quotes map[string]bool) []string {
+	return nil
+}
+
+func (Adapter) Search_listed_tokens(search []string, quotes map[string]bool) []string {
+	return Get_listed_tokens(search, quotes)
+}
+
+func (Adapter) Place_sell_order(pair string, quantity, price float64) (string, bool) {
+	return Place_sell_order(pair, quantity, price)
+}
+
+func (Adapter) Get_order(pair, side, order_id string) utils.Order_status {
+	return Get_order(pair, side, order_id)
+}
+
+func (Adapter) Start_transfer(asset, destination string, amount float64) (string, bool) {
+	return Start_transfer(asset, destination, amount)
+}
+
+func (Adapter) Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
+	return Get_withdrawal_txid(asset, withdrawal_id)
+}
+
+func (Adapter) Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+	return Check_if_transferred(asset, txid, amount, since, matched)
+}
+
+func (Adapter) Place_buy_order(pair string, quantity, price float64) (string, bool) {
+	return Place_buy_order(pair, quantity, price)
+}
+
+func (Adapter) Cancel_order(pair, side, order_id string) bool {
+	return Cancel_order(pair, side, order_id)
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	// utility
 	"../../utils"
@@ -25,6 +27,7 @@ type Deposits struct {
 		Transaction_value string  `json:"transaction_value"`
 		Fee               string  `json:"fee"`
 		Status            int     `json:"status,Number"`
+		AddTime           int64   `json:"addTime"`
 	} `json:"records"`
 }
 
@@ -53,6 +56,16 @@ type Orders struct {
 	} `json:"orders"`
 }
 
+// fee of a filled order, in whatever the order received
+// ex: {"data": {"fee": "0.0036", "order_id": 123, "type": "sell"}, "result": true}
+type Order_fee struct {
+	Success bool `json:"result"`
+	Data    struct {
+		Fee  float64 `json:"fee,string"`
+		Type string  `json:"type"`
+	} `json:"data"`
+}
+
 type Holdings struct {
 	Info struct {
 		Funds struct {
@@ -69,8 +82,13 @@ type Prices struct {
 		Sell string `json:"sell,Number"`
 		Buy  string `json:"buy,Number"`
 		Last string `json:"last,Number"`
+		Vol  string `json:"vol,Number"`
 	} `json:"ticker"`
-	Date string `json:"date"`
+}
+
+type Depth struct {
+	Bids [][]interface{} `json:"bids"`
+	Asks [][]interface{} `json:"asks"`
 }
 
 func Initialize(url, key, secret, tradepw, eth_fee string) {
@@ -100,16 +118,29 @@ func Get_balances(tokens map[string]bool) map[string]float64 {
 	body = execute("POST", api_url, endpoint, params)
 	// check if there's a way to deal with timeouts and errors here
 	err := json.Unmarshal(body, &data)
-	if err != nil {
+	if utils.Api_schema_error("okex", err) {
+		return holdings
+	}
+
+	// error responses leave out funds altogether
+	free, ok := data.Info.Funds.Free.(map[string]interface{})
+	if !ok {
+		utils.Api_schema_error("okex", fmt.Errorf("free funds are %T, not an object", data.Info.Funds.Free))
 		return holdings
 	}
 
 	// remove tokens that we don't care about
-	for token, amount := range data.Info.Funds.Free.(map[string]interface{}) {
+	for token, value := range free {
+
+		amount, ok := value.(string)
+		if !ok {
+			utils.Api_schema_error("okex", fmt.Errorf("free %s is %T, not a string", token, value))
+			continue
+		}
 
-		if amount.(string) != "" {
+		if amount != "" {
 			token = strings.ToUpper(token)
-			amount, err := strconv.ParseFloat(amount.(string), 64)
+			amount, err := strconv.ParseFloat(amount, 64)
 			utils.Check(err)
 
 			if tokens[token] {
@@ -121,69 +152,115 @@ func Get_balances(tokens map[string]bool) map[string]float64 {
 	return holdings
 }
 
-func Get_price(tokens map[string]bool) map[string]float64 {
+func Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	return utils.Ticker_prices(Get_tickers(tokens, quotes))
+
+}
+
+// okex's date is its server time, not when the market last traded
+func Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
 
 	var endpoint = "/ticker.do"
-	var prices = make(map[string]float64)
-	var body []byte
+	var tickers = make(map[string]utils.Ticker)
+	var pairs []string
+	var mutex sync.Mutex
 
-	// perform api call per token
 	for token, _ := range tokens {
+		for quote, _ := range quotes {
+			if token != quote {
+				pairs = append(pairs, utils.Pair(token, quote))
+			}
+		}
+	}
+
+	// perform api call per market
+	utils.Parallel(pairs, func(pair string) {
 
 		var data = new(Prices)
-		var params = fmt.Sprintf("symbol=%s", token+"_ETH")
+		var params = fmt.Sprintf("symbol=%s", utils.Pair_symbol(pair, "_", false))
 
 		// perform api call
-		body = execute("GET", api_url, endpoint, params)
+		body := execute("GET", api_url, endpoint, params)
 
 		err := json.Unmarshal(body, &data)
-		if err != nil {
-			return prices
+		if utils.Api_schema_error("okex", err) || data.Data.Last == "" {
+			return
 		}
 
-		if data.Data.Last != "" {
-			price, err := strconv.ParseFloat(data.Data.Last, 64)
-			utils.Check(err)
+		price, err := strconv.ParseFloat(data.Data.Last, 64)
+		utils.Check(err)
 
-			prices[token+"-ETH"] = price
-		}
+		// volume is in the token
+		volume, _ := strconv.ParseFloat(data.Data.Vol, 64)
+
+		mutex.Lock()
+		tickers[pair] = utils.Ticker{Price: price, Volume: volume * price}
+		mutex.Unlock()
+
+	})
+
+	return tickers
+}
+
+func Get_order_book(pair string) utils.Order_book {
+
+	var endpoint = "/depth.do"
+	var params = fmt.Sprintf("size=%d&symbol=%s", 20, utils.Pair_symbol(pair, "_", false))
+	var data = new(Depth)
+	var body []byte
+
+	// perform api call
+	body = execute("GET", api_url, endpoint, params)
 
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return utils.Order_book{}
 	}
 
-	return prices
+	// okex sends asks highest first, sorting takes care of it
+	return utils.Sort_order_book(utils.Order_book{
+		Bids: utils.Parse_levels(data.Bids),
+		Asks: utils.Parse_levels(data.Asks),
+	})
+
 }
 
-func Get_listed_tokens(search []string) []string {
+func Get_listed_tokens(search []string, quotes map[string]bool) []string {
 
 	var endpoint = "/ticker.do"
 	var tokens []string
 	var body []byte
 
-	// perform api call per token
+	// perform api call per market
+	// a token listed on any of the quotes counts
 	for _, token := range search {
+		for quote, _ := range quotes {
 
-		var data = new(Prices)
-		var params = fmt.Sprintf("symbol=%s", token+"_ETH")
+			var data = new(Prices)
+			var params = fmt.Sprintf("symbol=%s", token+"_"+quote)
 
-		// perform api call
-		body = execute("GET", api_url, endpoint, params)
+			// perform api call
+			body = execute("GET", api_url, endpoint, params)
 
-		err := json.Unmarshal(body, &data)
-		if err != nil || data.Data.Buy == "" {
-			continue
-		}
+			err := json.Unmarshal(body, &data)
+			if err != nil || data.Data.Buy == "" {
+				continue
+			}
 
-		tokens = append(tokens, token)
+			tokens = append(tokens, token)
+			break
 
+		}
 	}
 
 	return tokens
 }
 
-func Place_sell_order(token string, quantity int, price float64) (transaction_id string, sell_placed bool) {
+func Place_sell_order(pair string, quantity, price float64) (transaction_id string, sell_placed bool) {
 
 	var endpoint = "/trade.do"
-	var params = fmt.Sprintf("amount=%d&api_key=%s&price=%f&symbol=%s&type=%s", quantity, api_key, price, token+"_ETH", "sell")
+	var params = fmt.Sprintf("amount=%f&api_key=%s&price=%f&symbol=%s&type=%s", quantity, api_key, price, utils.Pair_symbol(pair, "_", false), "sell")
 	var signature = make_signature(params + "&secret_key=" + api_secret)
 	var place_order = new(Place_order)
 	var body []byte
@@ -204,11 +281,10 @@ func Place_sell_order(token string, quantity int, price float64) (transaction_id
 
 }
 
-func Check_if_sold(token, sell_tx_id string) (float64, bool) {
+func Get_order(pair, side, order_id string) utils.Order_status {
 
-	var amount = 0.0
 	var endpoint = "/order_info.do"
-	var params = fmt.Sprintf("api_key=%s&order_id=%s&symbol=%s", api_key, sell_tx_id, token+"_ETH")
+	var params = fmt.Sprintf("api_key=%s&order_id=%s&symbol=%s", api_key, order_id, utils.Pair_symbol(pair, "_", false))
 	var signature = make_signature(params + "&secret_key=" + api_secret)
 	var orders = new(Orders)
 	var body []byte
@@ -221,21 +297,63 @@ func Check_if_sold(token, sell_tx_id string) (float64, bool) {
 	err := json.Unmarshal(body, &orders)
 	utils.Check(err)
 
+	// okex status -1 is cancelled and 2 fully filled
+	// orders missing from the response are left open
 	for _, order := range orders.List {
-		if order.Order_id.String() == sell_tx_id && order.Status == 2 {
-			return order.Amount * order.Price, true
+		if order.Order_id.String() == order_id {
+			status := utils.Order_status{
+				Open:     order.Status != -1 && order.Status != 2,
+				Quantity: order.Deal_amount,
+				Price:    order.Avg_price,
+			}
+
+			if status.Quantity > 0 {
+				status.Fee = get_order_fee(pair, side, order_id, status.Price)
+			}
+
+			return status
 		}
 	}
 
-	return amount, false
+	return utils.Order_status{Open: true}
 
 }
 
-func Start_transfer(token, destination string, amount float64) (string, bool) {
+// order info leaves out the fee, which okex keeps separately
+// buys pay it in the token, converted to the quote at the fill price
+func get_order_fee(pair, side, order_id string, price float64) float64 {
 
+	var endpoint = "/order_fee.do"
+	var params = fmt.Sprintf("api_key=%s&order_id=%s&symbol=%s", api_key, order_id, utils.Pair_symbol(pair, "_", false))
+	var signature = make_signature(params + "&secret_key=" + api_secret)
+	var fee = new(Order_fee)
+	var body []byte
+
+	params = params + "&sign=" + signature
+
+	// perform api call
+	body = execute("POST", api_url, endpoint, params)
+
+	err := json.Unmarshal(body, &fee)
+	if utils.Api_schema_error("okex", err) || !fee.Success {
+		return 0
+	}
+
+	if side == "buy" {
+		return fee.Data.Fee * price
+	}
+
+	return fee.Data.Fee
+
+}
+
+func Start_transfer(asset, destination string, amount float64) (string, bool) {
+
+	// withdrawals name the asset against usd, ie "eth_usd"
+	// whatever market it is actually traded on
 	var endpoint = "/withdraw.do"
 	var params = fmt.Sprintf("api_key=%s&chargefee=0.01&symbol=%s&target=address&trade_pwd=%s&withdraw_address=%s&withdraw_amount=%f",
-		api_key, token+"_ETH", api_tradepw, destination, amount)
+		api_key, strings.ToLower(asset)+"_usd", api_tradepw, destination, amount)
 	var signature = make_signature(params + "&secret_key=" + api_secret)
 	var transfer = new(Place_transfer)
 	var body []byte
@@ -256,12 +374,20 @@ func Start_transfer(token, destination string, amount float64) (string, bool) {
 
 }
 
-func Check_if_transferred(sell_cost float64) bool {
+// okex withdrawal records don't include the chain txid
+func Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
+
+	return "", false
+
+}
+
+func Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
 
 	var endpoint = "/account_records.do"
-	var params = fmt.Sprintf("api_key=%s&current_page=1&page_length=10&symbol=eth&type=0", api_key)
+	var params = fmt.Sprintf("api_key=%s&current_page=1&page_length=10&symbol=%s&type=0", api_key, strings.ToLower(asset))
 	var signature = make_signature(params + "&secret_key=" + api_secret)
 	var deposits = new(Deposits)
+	var list []utils.Deposit
 	var body []byte
 
 	params = params + "&sign=" + signature
@@ -273,20 +399,30 @@ func Check_if_transferred(sell_cost float64) bool {
 	utils.Check(err)
 
 	for _, deposit := range deposits.List {
-		if deposit.Amount == sell_cost && deposit.Status == 1 {
-			return true
+
+		if deposit.Status != 1 {
+			continue
 		}
+
+		// records have no id either, the time and amount identify them
+		list = append(list, utils.Deposit{
+			Id:        fmt.Sprintf("%d-%f", deposit.AddTime, deposit.Amount),
+			Amount:    deposit.Amount,
+			Timestamp: time.Unix(0, deposit.AddTime*int64(time.Millisecond)),
+		})
+
 	}
 
-	return false
+	// okex deposit records carry no txid
+	// so they can only be matched on amount
+	return utils.Match_deposit(list, "", amount, since, matched)
 
 }
 
-func Place_buy_order(token string, amount, price float64) (string, bool) {
+func Place_buy_order(pair string, amount, price float64) (string, bool) {
 
-	token += "_ETH"
 	var endpoint = "/trade.do"
-	var params = fmt.Sprintf("amount=%f&api_key=%s&price=%f&symbol=%s&type=%s", amount, api_key, price, token, "buy")
+	var params = fmt.Sprintf("amount=%f&api_key=%s&price=%f&symbol=%s&type=%s", amount, api_key, price, utils.Pair_symbol(pair, "_", false), "buy")
 	var signature = make_signature(params + "&secret_key=" + api_secret)
 	var place_order = new(Place_order)
 	var body []byte
@@ -307,12 +443,12 @@ func Place_buy_order(token string, amount, price float64) (string, bool) {
 
 }
 
-func Check_if_bought(token, buy_tx_id string) bool {
+func Cancel_order(pair, side, order_id string) bool {
 
-	var endpoint = "/order_info.do"
-	var params = fmt.Sprintf("api_key=%s&order_id=%s&symbol=%s", api_key, buy_tx_id, token+"_ETH")
+	var endpoint = "/cancel_order.do"
+	var params = fmt.Sprintf("api_key=%s&order_id=%s&symbol=%s", api_key, order_id, utils.Pair_symbol(pair, "_", false))
 	var signature = make_signature(params + "&secret_key=" + api_secret)
-	var orders = new(Orders)
+	var cancel_order = new(Place_order)
 	var body []byte
 
 	params = params + "&sign=" + signature
@@ -320,16 +456,10 @@ func Check_if_bought(token, buy_tx_id string) bool {
 	// perform api call
 	body = execute("POST", api_url, endpoint, params)
 
-	err := json.Unmarshal(body, &orders)
+	err := json.Unmarshal(body, &cancel_order)
 	utils.Check(err)
 
-	for _, order := range orders.List {
-		if order.Order_id.String() == buy_tx_id && order.Status == 2 {
-			return true
-		}
-	}
-
-	return false
+	return cancel_order.Success
 
 }
 
@@ -348,11 +478,22 @@ func execute(method string, url string, endpoint string, params string) []byte {
 
 	req.Header.Add("Accept", "application/json")
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: utils.Request_timeout}
+
+	utils.Wait_turn("okex")
 
+	started := time.Now()
 	res, err := client.Do(req)
 	utils.Check(err)
 
+	status := 0
+
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	utils.Api_call("okex", started, status, err)
+
 	if res != nil {
 
 		defer res.Body.Close()
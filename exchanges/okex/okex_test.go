@@ -0,0 +1,113 @@
+package okex
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	// common exchange interface and registry
+	"../../exchanges"
+)
+
+// stands in for okex's order endpoints, the buy stays open until
+// it's cancelled, having filled 4 of 10 by then
+// refusing answers cancels the way okex does for unknown orders
+func stand_in(t *testing.T, refuse bool) (*httptest.Server, *url.Values) {
+
+	cancelled := false
+	cancel := new(url.Values)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		query := r.URL.Query()
+
+		// the signature covers every param before it, in order
+		signed := strings.Split(r.URL.RawQuery, "&sign=")[0]
+
+		if query.Get("api_key") != "key" || query.Get("sign") != make_signature(signed+"&secret_key=secret") {
+			t.Errorf("%s %s sent without key or a valid signature", r.Method, r.URL.Path)
+		}
+
+		switch r.Method + " " + r.URL.Path {
+
+		case "POST /cancel_order.do":
+			*cancel = query
+
+			if refuse {
+				w.Write([]byte(`{"result": false, "error_code": 10009}`))
+				return
+			}
+
+			cancelled = true
+			w.Write([]byte(`{"result": true, "order_id": 42}`))
+
+		case "POST /order_info.do":
+			if cancelled {
+				w.Write([]byte(`{"result": true, "orders": [{"amount": 10, "avg_price": 0.002, "deal_amount": 4, "order_id": 42, "orders_id": 42, "price": 0.002, "status": -1, "symbol": "link_eth", "type": "buy"}]}`))
+			} else {
+				w.Write([]byte(`{"result": true, "orders": [{"amount": 10, "avg_price": 0.002, "deal_amount": 4, "order_id": 42, "orders_id": 42, "price": 0.002, "status": 1, "symbol": "link_eth", "type": "buy"}]}`))
+			}
+
+		case "POST /order_fee.do":
+			w.Write([]byte(`{"result": true, "data": {"fee": "0.004", "order_id": 42, "type": "buy"}}`))
+
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+
+		}
+
+	}))
+
+	api_url = server.URL
+	api_key = "key"
+	api_secret = "secret"
+
+	return server, cancel
+
+}
+
+func TestCancel_order(t *testing.T) {
+
+	server, cancel := stand_in(t, false)
+	defer server.Close()
+
+	if order := Get_order("LINK-ETH", "buy", "42"); !order.Open || order.Quantity != 4 {
+		t.Errorf("partially filled order parsed as %+v", order)
+	}
+
+	// orders okex doesn't know of yet are left open
+	if !Get_order("LINK-ETH", "buy", "43").Open {
+		t.Error("order missing from the response isn't open")
+	}
+
+	order, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "buy", "42")
+
+	if cancel.Get("order_id") != "42" || cancel.Get("symbol") != "LINK_ETH" {
+		t.Errorf("cancel sent as %v", *cancel)
+	}
+
+	// buys pay the fee in the token, reported in the quote
+	if !cancelled || !order.Done() || order.Quantity != 4 || order.Price != 0.002 || math.Abs(order.Fee-0.000008) > 1e-12 {
+		t.Errorf("cancelled order reported as %+v, %v", order, cancelled)
+	}
+
+}
+
+func TestCancel_order_refused(t *testing.T) {
+
+	server, _ := stand_in(t, true)
+	defer server.Close()
+
+	if Cancel_order("LINK-ETH", "buy", "42") {
+		t.Error("refused cancel reported as cancelled")
+	}
+
+	if _, cancelled := exchanges.Cancel_expired(Adapter{}, "LINK-ETH", "buy", "42"); cancelled {
+		t.Error("order still open after a refused cancel reported as cancelled")
+	}
+
+}
@@ -0,0 +1,607 @@
+package paper
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	// database package
+	"../../db/mongo"
+
+	// utility
+	"../../utils"
+)
+
+// anything that can quote prices for one exchange
+// real exchange adapters satisfy this, as does Recorded below
+type Quoter interface {
+	Get_price(tokens, quotes map[string]bool) map[string]float64
+	Get_listed_tokens(quotes map[string]bool) []string
+}
+
+type order struct {
+	Exchange string
+	Pair     string
+	Side     string
+	Quantity float64
+	Price    float64
+	Filled   bool
+}
+
+type deposit struct {
+	Id       string
+	Txid     string
+	Exchange string
+	Token    string
+	Amount   float64
+	Lands    time.Time
+	Credited bool
+}
+
+// the simulator is shared by all paper exchanges
+// since withdrawals move funds from one to another
+var mutex sync.Mutex
+
+// virtual balances per exchange
+// ex: ["binance"]["ETH"] = 1.5
+var balances = make(map[string]map[string]float64)
+
+// last quoted prices per exchange, used for filling orders
+var last_prices = make(map[string]map[string]float64)
+
+var orders = make(map[string]*order)
+var deposits []*deposit
+var next_id int
+
+// order, withdrawal and deposit ids are told apart from ones
+// of earlier runs, since the database keeps all of them
+var run_id = strconv.FormatInt(time.Now().Unix(), 36)
+
+// withdrawal fees per exchange and asset, same as the fees map in main.go
+// ex: ["binance"]["ETH"] = 0.01
+var fees = make(map[string]map[string]float64)
+
+// percent taken on every filled order, same as trade_fees in main.go
+// ex: ["binance"] = 0.1
+var trade_fees = make(map[string]float64)
+
+// deposit address -> exchange name
+// built from <EXCHANGE>_<TOKEN>_ADDRESS props
+var addresses = make(map[string]string)
+
+var withdrawal_delay time.Duration
+
+// when replaying recorded prices the simulator runs on its own clock
+// which moves forward by one minute on every Tick()
+var replaying bool
+var replay_at time.Time
+
+// prices handed over by a backtest, quoted by Streamed
+var streamed = make(map[string]map[string]float64)
+
+func Initialize(exchange_fees map[string]map[string]float64, exchange_trade_fees map[string]float64, address_book map[string]string, starting_balances map[string]float64, delay time.Duration) {
+
+	fmt.Println("initializing paper package")
+
+	fees = exchange_fees
+	trade_fees = exchange_trade_fees
+	addresses = address_book
+	withdrawal_delay = delay
+
+	for exchange := range exchange_fees {
+		set_starting_balances(exchange, starting_balances)
+	}
+
+	for _, exchange := range address_book {
+		set_starting_balances(exchange, starting_balances)
+	}
+
+}
+
+// addresses outside of any exchange, such as a cold wallet
+// receive simulated withdrawals but start out empty
+func Add_wallet(address, name string) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	addresses[address] = name
+
+}
+
+// switches the simulator clock to recorded time
+// starting at the given moment in the prices collection
+func Replay_from(start time.Time) {
+
+	replaying = true
+	replay_at = start
+
+}
+
+// used by backtests, which walk through recorded prices
+// at their own pace instead of one minute per Tick()
+func Set_prices(at time.Time, prices map[string]map[string]float64) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	replaying = true
+	replay_at = at
+	streamed = prices
+
+}
+
+// total virtual holdings per exchange, including funds
+// held by open orders and deposits still in transit
+// ex: ["binance"]["ETH"] = 1.5
+func Balances() map[string]map[string]float64 {
+
+	var totals = make(map[string]map[string]float64)
+
+	add := func(exchange, token string, amount float64) {
+		if totals[exchange] == nil {
+			totals[exchange] = make(map[string]float64)
+		}
+		totals[exchange][token] += amount
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	land_deposits()
+
+	for exchange, tokens := range balances {
+		for token, amount := range tokens {
+			add(exchange, token, amount)
+		}
+	}
+
+	for _, o := range orders {
+
+		if o.Filled {
+			continue
+		}
+
+		if o.Side == "sell" {
+			add(o.Exchange, utils.Pair_token(o.Pair), o.Quantity)
+		} else {
+			add(o.Exchange, utils.Pair_quote(o.Pair), o.Quantity*o.Price)
+		}
+
+	}
+
+	for _, d := range deposits {
+		if !d.Credited {
+			add(d.Exchange, d.Token, d.Amount)
+		}
+	}
+
+	return totals
+
+}
+
+func Tick() {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if replaying {
+		replay_at = replay_at.Add(time.Minute)
+	}
+
+}
+
+func Now() time.Time {
+
+	if replaying {
+		return replay_at
+	}
+
+	return time.Now()
+
+}
+
+// simulated exchange, quotes come from the Quoter
+// while orders and transfers only touch virtual balances
+type Adapter struct {
+	Name   string
+	Quoter Quoter
+}
+
+func (a Adapter) Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	prices := a.Quoter.Get_price(tokens, quotes)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	last_prices[a.Name] = prices
+	fill_orders(a.Name)
+
+	return prices
+
+}
+
+// uses the real order book when the Quoter has one
+// otherwise the last price is treated as infinitely deep
+func (a Adapter) Get_order_book(pair string) utils.Order_book {
+
+	if books, ok := a.Quoter.(interface {
+		Get_order_book(pair string) utils.Order_book
+	}); ok {
+		return books.Get_order_book(pair)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	price := last_prices[a.Name][pair]
+
+	if price == 0 {
+		return utils.Order_book{}
+	}
+
+	level := []utils.Order_level{{Price: price, Quantity: math.MaxFloat64}}
+
+	return utils.Order_book{Bids: level, Asks: level}
+
+}
+
+func (a Adapter) Get_balances(tokens map[string]bool) map[string]float64 {
+
+	var holdings = make(map[string]float64)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	land_deposits()
+
+	for token, amount := range balances[a.Name] {
+		if tokens[token] {
+			holdings[token] = amount
+		}
+	}
+
+	return holdings
+
+}
+
+func (a Adapter) Get_listed_tokens(quotes map[string]bool) []string {
+
+	return a.Quoter.Get_listed_tokens(quotes)
+
+}
+
+func (a Adapter) Place_sell_order(pair string, quantity, price float64) (string, bool) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	token := utils.Pair_token(pair)
+	amount := quantity
+
+	// tokens are held by the order until it fills
+	if get_balance(a.Name, token) < amount {
+		return "", false
+	}
+
+	add_balance(a.Name, token, -amount)
+
+	return place_order(a.Name, pair, "sell", amount, price), true
+
+}
+
+func (a Adapter) Start_transfer(asset, destination string, amount float64) (string, bool) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	to, ok := addresses[destination]
+
+	// a real exchange would refuse an unknown address too
+	if !ok || get_balance(a.Name, asset) < amount {
+		return "", false
+	}
+
+	add_balance(a.Name, asset, -amount)
+
+	fee := fees[a.Name][asset]
+
+	next_id++
+	id := "paper-withdrawal-" + run_id + "-" + strconv.Itoa(next_id)
+
+	deposits = append(deposits, &deposit{
+		Id:       id,
+		Txid:     "paper-tx-" + run_id + "-" + strconv.Itoa(next_id),
+		Exchange: to,
+		Token:    asset,
+		Amount:   amount - fee,
+		Lands:    Now().Add(withdrawal_delay),
+	})
+
+	return id, true
+
+}
+
+func (a Adapter) Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, d := range deposits {
+		if d.Id == withdrawal_id {
+			return d.Txid, true
+		}
+	}
+
+	return "", false
+
+}
+
+func (a Adapter) Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	land_deposits()
+
+	var list []utils.Deposit
+
+	for _, d := range deposits {
+		if d.Exchange == a.Name && d.Token == asset && d.Credited {
+			list = append(list, utils.Deposit{Id: d.Id, Txid: d.Txid, Amount: d.Amount, Timestamp: d.Lands})
+		}
+	}
+
+	// simulated deposits all come from our own withdrawals
+	// and land on the simulator's clock, not the one since is on
+	return utils.Match_deposit(list, txid, amount, time.Time{}, matched)
+
+}
+
+func (a Adapter) Place_buy_order(pair string, quantity, price float64) (string, bool) {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	quote := utils.Pair_quote(pair)
+	cost := quantity * price
+	cost += trade_fee(a.Name, &order{Quantity: quantity, Price: price})
+
+	// the quote, fee included, is held by the order until it fills
+	if get_balance(a.Name, quote) < cost {
+		return "", false
+	}
+
+	add_balance(a.Name, quote, -cost)
+
+	return place_order(a.Name, pair, "buy", quantity, price), true
+
+}
+
+func (a Adapter) Get_order(pair, side, order_id string) utils.Order_status {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	o, ok := orders[order_id]
+
+	// cancelled orders are forgotten, nothing of them filled
+	if !ok {
+		return utils.Order_status{}
+	}
+
+	// simulated orders fill all at once
+	if !o.Filled {
+		return utils.Order_status{Open: true}
+	}
+
+	return utils.Order_status{Quantity: o.Quantity, Price: o.Price, Fee: trade_fee(a.Name, o)}
+
+}
+func (a Adapter) Cancel_order(pair, side, order_id string) bool {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	o, ok := orders[order_id]
+
+	// filled orders can no longer be cancelled
+	if !ok || o.Filled || o.Exchange != a.Name {
+		return false
+	}
+
+	// release whatever the order was holding
+	if o.Side == "sell" {
+		add_balance(a.Name, utils.Pair_token(o.Pair), o.Quantity)
+	} else {
+		add_balance(a.Name, utils.Pair_quote(o.Pair), o.Quantity*o.Price+trade_fee(a.Name, o))
+	}
+
+	delete(orders, order_id)
+
+	return true
+
+}
+
+// prices recorded by mongo.Save_prices, read back
+// at the simulator clock instead of asking the exchange
+type Recorded struct {
+	Exchange string
+}
+
+func (r Recorded) Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	var prices = make(map[string]float64)
+
+	at := Now()
+	recorded := mongo.Get_exchange_prices(r.Exchange, at.Add(-time.Minute), at)
+
+	for pair, price := range recorded {
+		if tokens[utils.Pair_token(pair)] && quotes[utils.Pair_quote(pair)] {
+			prices[pair] = price
+		}
+	}
+
+	return prices
+
+}
+
+func (r Recorded) Get_listed_tokens(quotes map[string]bool) []string {
+
+	var tokens []string
+
+	at := Now()
+
+	for pair := range mongo.Get_exchange_prices(r.Exchange, at.Add(-time.Minute), at) {
+		if quotes[utils.Pair_quote(pair)] && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
+		}
+	}
+
+	return tokens
+
+}
+
+// prices handed over through Set_prices
+type Streamed struct {
+	Exchange string
+}
+
+func (r Streamed) Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	var prices = make(map[string]float64)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for pair, price := range streamed[r.Exchange] {
+		if tokens[utils.Pair_token(pair)] && quotes[utils.Pair_quote(pair)] {
+			prices[pair] = price
+		}
+	}
+
+	return prices
+
+}
+
+func (r Streamed) Get_listed_tokens(quotes map[string]bool) []string {
+
+	var tokens []string
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for pair := range streamed[r.Exchange] {
+		if quotes[utils.Pair_quote(pair)] && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
+		}
+	}
+
+	return tokens
+
+}
+
+func place_order(exchange, pair, side string, quantity, price float64) string {
+
+	next_id++
+	id := "paper-order-" + run_id + "-" + strconv.Itoa(next_id)
+
+	orders[id] = &order{
+		Exchange: exchange,
+		Pair:     pair,
+		Side:     side,
+		Quantity: quantity,
+		Price:    price,
+	}
+
+	// the market may already be past our limit
+	fill_orders(exchange)
+
+	return id
+
+}
+
+// limit orders fill once the quoted price crosses them
+func fill_orders(exchange string) {
+
+	for _, o := range orders {
+
+		if o.Filled || o.Exchange != exchange {
+			continue
+		}
+
+		price := last_prices[exchange][o.Pair]
+
+		if price == 0 {
+			continue
+		}
+
+		// the fee is paid in the quote, sells have it taken out of
+		// what they receive and buys held it when placed
+		if o.Side == "sell" && price >= o.Price {
+			o.Filled = true
+			add_balance(exchange, utils.Pair_quote(o.Pair), o.Quantity*o.Price-trade_fee(exchange, o))
+		}
+
+		if o.Side == "buy" && price <= o.Price {
+			o.Filled = true
+			add_balance(exchange, utils.Pair_token(o.Pair), o.Quantity)
+		}
+
+	}
+
+}
+
+// trading fee of a filled order, in the quote
+func trade_fee(exchange string, o *order) float64 {
+
+	return o.Quantity * o.Price * trade_fees[exchange] / 100
+
+}
+
+// credits withdrawals that have spent long enough in transit
+func land_deposits() {
+
+	now := Now()
+
+	for _, d := range deposits {
+		if !d.Credited && !now.Before(d.Lands) {
+			d.Credited = true
+			add_balance(d.Exchange, d.Token, d.Amount)
+		}
+	}
+
+}
+
+func set_starting_balances(exchange string, starting map[string]float64) {
+
+	if _, ok := balances[exchange]; ok {
+		return
+	}
+
+	balances[exchange] = make(map[string]float64)
+
+	for token, amount := range starting {
+		balances[exchange][token] = amount
+	}
+
+}
+
+func get_balance(exchange, token string) float64 {
+
+	return balances[exchange][token]
+
+}
+
+func add_balance(exchange, token string, amount float64) {
+
+	if balances[exchange] == nil {
+		balances[exchange] = make(map[string]float64)
+	}
+
+	balances[exchange][token] += amount
+
+}
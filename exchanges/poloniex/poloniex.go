@@ -1,21 +1,512 @@
 package poloniex
 
 import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	// utility
+	"../../utils"
 )
 
-var url, key, secret string
+var api_url, api_key, api_secret string
+var api_eth_fee float64
+
+type Transfer_request struct {
+	Response string      `json:"response"`
+	Id       json.Number `json:"withdrawalNumber"`
+	Error    string      `json:"error"`
+}
+
+type Deposits struct {
+	List []struct {
+		Currency      string  `json:"currency"`
+		Address       string  `json:"address"`
+		Amount        float64 `json:"amount,string"`
+		Confirmations int     `json:"confirmations"`
+		Txid          string  `json:"txid"`
+		Timestamp     int64   `json:"timestamp"`
+		Status        string  `json:"status"`
+	} `json:"deposits"`
+	// status is "COMPLETE: <txid>" once sent
+	Withdrawals []struct {
+		Id       json.Number `json:"withdrawalNumber"`
+		Currency string      `json:"currency"`
+		Amount   float64     `json:"amount,string"`
+		Status   string      `json:"status"`
+	} `json:"withdrawals"`
+	Error string `json:"error"`
+}
+
+type Place_order struct {
+	Id    string `json:"orderNumber"`
+	Error string `json:"error"`
+}
+
+type Cancel_request struct {
+	Success int    `json:"success"`
+	Error   string `json:"error"`
+}
+
+type Open_orders []struct {
+	Id     string  `json:"orderNumber"`
+	Type   string  `json:"type"`
+	Rate   float64 `json:"rate,string"`
+	Amount float64 `json:"amount,string"`
+	Total  float64 `json:"total,string"`
+}
+
+type Trades []struct {
+	Pair   string  `json:"currencyPair"`
+	Type   string  `json:"type"`
+	Rate   float64 `json:"rate,string"`
+	Amount float64 `json:"amount,string"`
+	Total  float64 `json:"total,string"`
+	Fee    float64 `json:"fee,string"`
+}
+
+// poloniex returns balances keyed by currency, what's on
+// order is listed separately from what's available
+// ex: {"ETH": {"available": "1.5", "onOrders": "0.2", ...}}
+type Holdings map[string]struct {
+	Available float64 `json:"available,string"`
+	OnOrders  float64 `json:"onOrders,string"`
+}
+
+// poloniex uses the pair as the key itself
+// ex: {"ETH_NULS": {"last": "0.0012", ...}}
+type Prices map[string]Price
+
+type Price struct {
+	Last       string `json:"last"`
+	LowestAsk  string `json:"lowestAsk"`
+	HighestBid string `json:"highestBid"`
+	BaseVolume string `json:"baseVolume"`
+	IsFrozen   string `json:"isFrozen"`
+}
+
+type Depth struct {
+	Bids  [][]interface{} `json:"bids"`
+	Asks  [][]interface{} `json:"asks"`
+	Error string          `json:"error"`
+}
+
+func Initialize(url, key, secret, eth_fee string) {
+
+	fmt.Println("initializing poloniex package")
+
+	api_url = url
+	api_key = key
+	api_secret = secret
+	api_eth_fee, _ = strconv.ParseFloat(eth_fee, 64)
+
+}
+
+func Get_balances(tokens map[string]bool) map[string]float64 {
+
+	var params = "command=returnCompleteBalances"
+	var holdings = make(map[string]float64)
+	var data = make(Holdings)
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return holdings
+	}
+
+	// remove tokens that we don't care about
+	for symbol, value := range data {
+
+		if tokens[symbol] {
+			holdings[symbol] = value.Available
+		}
+
+	}
+
+	return holdings
+
+}
+
+func Get_price(tokens, quotes map[string]bool) map[string]float64 {
+
+	return utils.Ticker_prices(Get_tickers(tokens, quotes))
+
+}
+
+// poloniex doesn't say when a market last traded
+func Get_tickers(tokens, quotes map[string]bool) map[string]utils.Ticker {
+
+	var params = "command=returnTicker"
+	var tickers = make(map[string]utils.Ticker)
+	var data = make(Prices)
+	var body []byte
+
+	// perform api call
+	body = execute(params, false)
+
+	err := json.Unmarshal(body, &data)
+	if utils.Api_schema_error("poloniex", err) {
+		return tickers
+	}
+
+	// parse data and format for return
+	for symbol, v := range data {
+
+		// poloniex formats pairs backwards as "ETH_LINK"
+		// we're going to instead use kucoin's format "LINK-ETH"
+		pair, ok := utils.Symbol_pair(symbol, "_", true, quotes)
+
+		// frozen markets still report their last price
+		if !ok || !tokens[utils.Pair_token(pair)] || v.IsFrozen == "1" {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(v.Last, 64)
+		utils.Check(err)
+
+		// poloniex's base volume is in our quote
+		volume, err := strconv.ParseFloat(v.BaseVolume, 64)
+		utils.Check(err)
+
+		if price > 0 {
+			tickers[pair] = utils.Ticker{Price: price, Volume: volume}
+		}
+	}
+
+	return tickers
+
+}
+
+func Get_order_book(pair string) utils.Order_book {
+
+	var params = fmt.Sprintf("command=returnOrderBook&currencyPair=%s&depth=%d", utils.Pair_symbol(pair, "_", true), 20)
+	var data = new(Depth)
+	var body []byte
+
+	// perform api call
+	body = execute(params, false)
+
+	err := json.Unmarshal(body, &data)
+	if err != nil || data.Error != "" {
+		return utils.Order_book{}
+	}
+
+	return utils.Sort_order_book(utils.Order_book{
+		Bids: utils.Parse_levels(data.Bids),
+		Asks: utils.Parse_levels(data.Asks),
+	})
+
+}
+
+func Get_listed_tokens(quotes map[string]bool) []string {
+
+	var params = "command=returnTicker"
+	var tokens []string
+	var data = make(Prices)
+	var body []byte
+
+	// perform api call
+	body = execute(params, false)
+
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return tokens
+	}
+
+	// parse data and format for return
+	for symbol, v := range data {
+
+		// poloniex formats pairs backwards as "ETH_LINK"
+		// a token listed on several quotes is only counted once
+		pair, ok := utils.Symbol_pair(symbol, "_", true, quotes)
+
+		if ok && v.IsFrozen != "1" && !utils.StringInSlice(utils.Pair_token(pair), tokens) {
+			tokens = append(tokens, utils.Pair_token(pair))
+		}
+	}
+
+	return tokens
+
+}
+
+func Place_sell_order(pair string, quantity, price float64) (transaction_id string, sell_placed bool) {
+
+	var params = fmt.Sprintf("command=sell&currencyPair=%s&rate=%f&amount=%f", utils.Pair_symbol(pair, "_", true), price, quantity)
+	var place_order = new(Place_order)
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &place_order)
+	utils.Check(err)
+
+	if place_order.Error != "" || place_order.Id == "" {
+		return "", false
+	}
+
+	return place_order.Id, true
+
+}
+
+func Get_order(pair, side, order_id string) utils.Order_status {
+
+	status := utils.Order_status{Open: is_open(pair, order_id)}
+	cost := 0.0
+
+	// trades of the order tell us how much filled so far
+	// poloniex fees are a fraction of each trade
+	for _, t := range get_order_trades(order_id) {
+		status.Quantity += t.Amount
+		status.Fee += t.Total * t.Fee
+		cost += t.Total
+	}
 
-func Initialize(api_url string, api_key string, api_secret string) {
+	if status.Quantity > 0 {
+		status.Price = cost / status.Quantity
+	}
 
-	url = api_url
-	key = api_key
-	secret = api_secret
+	return status
 
 }
 
-func Test() {
+func Start_transfer(asset, destination string, amount float64) (string, bool) {
+
+	var params = fmt.Sprintf("command=withdraw&currency=%s&amount=%f&address=%s", asset, amount, destination)
+	var transfer = new(Transfer_request)
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &transfer)
+	utils.Check(err)
+
+	// along with a message such as "Withdrew 2.0 ETH."
+	if transfer.Error != "" || transfer.Response == "" {
+		return "", false
+	}
+
+	return transfer.Id.String(), true
+
+}
+
+func Get_withdrawal_txid(asset, withdrawal_id string) (string, bool) {
+
+	// transfers from before withdrawal ids were kept
+	if withdrawal_id == "" {
+		return "", false
+	}
+
+	var start = time.Now().AddDate(0, 0, -3).Unix()
+	var end = time.Now().Unix()
+	var params = fmt.Sprintf("command=returnDepositsWithdrawals&start=%d&end=%d", start, end)
+	var history = new(Deposits)
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &history)
+	utils.Check(err)
+
+	for _, w := range history.Withdrawals {
+		if w.Id.String() == withdrawal_id && strings.HasPrefix(w.Status, "COMPLETE: ") {
+			return strings.TrimPrefix(w.Status, "COMPLETE: "), true
+		}
+	}
+
+	return "", false
+
+}
+
+func Check_if_transferred(asset, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+
+	// look back far enough to cover slow transfers
+	var start = time.Now().AddDate(0, 0, -3).Unix()
+	var end = time.Now().Unix()
+	var params = fmt.Sprintf("command=returnDepositsWithdrawals&start=%d&end=%d", start, end)
+	var deposits = new(Deposits)
+	var list []utils.Deposit
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &deposits)
+	utils.Check(err)
+
+	// deposits are identified by their txid
+	for _, d := range deposits.List {
+		if d.Currency == asset && d.Status == "COMPLETE" {
+			list = append(list, utils.Deposit{
+				Id:        d.Txid,
+				Txid:      d.Txid,
+				Amount:    d.Amount,
+				Timestamp: time.Unix(d.Timestamp, 0),
+			})
+		}
+	}
+
+	return utils.Match_deposit(list, txid, amount, since, matched)
+
+}
+
+func Place_buy_order(pair string, quantity, price float64) (string, bool) {
+
+	var params = fmt.Sprintf("command=buy&currencyPair=%s&rate=%f&amount=%f", utils.Pair_symbol(pair, "_", true), price, quantity)
+	var place_order = new(Place_order)
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &place_order)
+	utils.Check(err)
+
+	if place_order.Error != "" || place_order.Id == "" {
+		return "", false
+	}
+
+	return place_order.Id, true
+
+}
+
+func Cancel_order(pair, side, order_id string) bool {
+
+	var params = fmt.Sprintf("command=cancelOrder&orderNumber=%s", order_id)
+	var cancel_order = new(Cancel_request)
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	err := json.Unmarshal(body, &cancel_order)
+	utils.Check(err)
+
+	return cancel_order.Success == 1
+
+}
+
+// checks whether the order is still sitting in the order book
+func is_open(pair, order_id string) bool {
+
+	var params = fmt.Sprintf("command=returnOpenOrders&currencyPair=%s", utils.Pair_symbol(pair, "_", true))
+	var orders = Open_orders{}
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	// on failure assume the order is still open
+	// rather than moving the transaction along
+	err := json.Unmarshal(body, &orders)
+	if err != nil {
+		return true
+	}
+
+	for _, o := range orders {
+		if o.Id == order_id {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+func get_order_trades(order_id string) Trades {
+
+	var params = fmt.Sprintf("command=returnOrderTrades&orderNumber=%s", order_id)
+	var trades = Trades{}
+	var body []byte
+
+	// perform api call
+	body = execute(params, true)
+
+	// poloniex returns an error object instead of a list
+	// when the order has no trades, treat that as no trades
+	err := json.Unmarshal(body, &trades)
+	if err != nil {
+		return Trades{}
+	}
+
+	return trades
+
+}
+
+func make_signature(params string) string {
+
+	mac := hmac.New(sha512.New, []byte(api_secret))
+	mac.Write([]byte(params))
+	return hex.EncodeToString(mac.Sum(nil))
+
+}
+
+func execute(params string, auth bool) []byte {
+
+	var req *http.Request
+	var err error
+
+	if auth {
+
+		// trading api takes a POST form body
+		// signed together with an increasing nonce
+		params += "&nonce=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+		req, err = http.NewRequest("POST", api_url+"/tradingApi", strings.NewReader(params))
+		utils.Check(err)
+
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Key", api_key)
+		req.Header.Add("Sign", make_signature(params))
+
+	} else {
+
+		req, err = http.NewRequest("GET", api_url+"/public?"+params, nil)
+		utils.Check(err)
+
+	}
+
+	req.Header.Add("Accept", "application/json")
+
+	client := &http.Client{Timeout: utils.Request_timeout}
+
+	utils.Wait_turn("poloniex")
+
+	started := time.Now()
+	res, err := client.Do(req)
+	utils.Check(err)
+
+	status := 0
+
+	if res != nil {
+		status = res.StatusCode
+	}
+
+	utils.Api_call("poloniex", started, status, err)
+
+	if res != nil {
+
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		utils.Check(err)
+
+		return body
+
+	}
 
-	fmt.Println(url)
+	return nil
 
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// what every exchange returned on one run
+// exchanges that didn't answer in time are missing from it
+type Snapshot struct {
+	Prices   map[string]map[string]float64
+	Tickers  map[string]map[string]utils.Ticker
+	Balances map[string]map[string]float64
+}
+
+type fetched struct {
+	name     string
+	prices   map[string]float64
+	tickers  map[string]utils.Ticker
+	balances map[string]float64
+}
+
+// fetches prices and balances from all exchanges at once
+// every exchange gets FETCH_TIMEOUT seconds to answer, anything
+// later is left out of the snapshot and counts as an api error
+// so that one slow exchange doesn't hold up the whole run
+// the timeout only bounds how long the run waits, requests already
+// sent aren't cancelled, each gives up after REQUEST_TIMEOUT on its
+// own and whatever a late exchange returns is abandoned
+func fetch_snapshot(tokens map[string]bool) Snapshot {
+
+	names := exchanges.Names()
+	timeout := time.Duration(prop_float("FETCH_TIMEOUT", 40) * float64(time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// buffered, so late exchanges don't block once we've moved on
+	results := make(chan fetched, len(names))
+	started := time.Now()
+
+	for _, name := range names {
+
+		exchange, _ := exchanges.Get(name)
+
+		go func(name string, exchange exchanges.Exchange) {
+			results <- fetch_exchange(name, exchange, tokens)
+		}(name, exchange)
+
+	}
+
+	snapshot := Snapshot{
+		Prices:   make(map[string]map[string]float64),
+		Tickers:  make(map[string]map[string]utils.Ticker),
+		Balances: make(map[string]map[string]float64),
+	}
+
+	answered := make(map[string]bool)
+
+	for range names {
+
+		select {
+
+		case r := <-results:
+			snapshot.Prices[r.name] = r.prices
+			snapshot.Tickers[r.name] = r.tickers
+			snapshot.Balances[r.name] = r.balances
+			answered[r.name] = true
+
+		case <-ctx.Done():
+			for _, name := range names {
+				if !answered[name] {
+					mongo.Log("Fetching from " + name + " timed out, left out of this run.")
+					utils.Api_call(name, started, 0, ctx.Err())
+				}
+			}
+
+			return snapshot
+
+		}
+
+	}
+
+	return snapshot
+
+}
+
+// prices, from tickers when the exchange has them, then balances
+// balances come second, since paper exchanges fill orders on prices
+func fetch_exchange(name string, exchange exchanges.Exchange, tokens map[string]bool) fetched {
+
+	f := fetched{name: name}
+
+	if ticker, ok := exchange.(exchanges.Ticker); ok {
+		f.tickers = ticker.Get_tickers(tokens, quotes)
+		f.prices = utils.Ticker_prices(f.tickers)
+	} else {
+		f.prices = exchange.Get_price(tokens, quotes)
+	}
+
+	f.balances = exchange.Get_balances(tokens)
+
+	return f
+
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// inventory strategy, used when both the quote and the token are
+// already held on both exchanges, sells on the expensive one
+// and buys on the cheap one at the same moment, no transfers
+// in between, balances are evened out separately by rebalancing
+func place_inventory_orders(pair string, c utils.Comparison) {
+
+	token := utils.Pair_token(pair)
+	quote := utils.Pair_quote(pair)
+	quantity := float64(trade_quantity[token])
+	cost := quantity * c.Ask_vwap * (1 + trade_fees[c.Ask_exchange]/100)
+
+	// both legs need to be covered before either is placed
+	if exchange_balances[c.Bid_exchange][token] < quantity || exchange_balances[c.Ask_exchange][quote] < cost {
+		return
+	}
+
+	if is_halted(token, c.Bid_exchange, c.Ask_exchange) || !allow_trade(token) {
+		return
+	}
+
+	sell_tx_id, sell_placed := place_order(c.Bid_exchange, "sell", pair, quantity, c.Bid_vwap, false)
+
+	if !sell_placed {
+		return
+	}
+
+	// a failed buy leaves buy_tx_id empty
+	// and it is placed again once the sell fills
+	buy_tx_id, _ := place_order(c.Ask_exchange, "buy", pair, quantity, c.Ask_vwap, false)
+
+	mongo.Place_inventory_orders(pair, c.Bid_exchange, sell_tx_id, c.Ask_exchange, buy_tx_id, c.Bid_vwap, c.Ask_vwap, quantity)
+
+	// balances are only refreshed once per run
+	// keep them honest for the rest of this one
+	exchange_balances[c.Bid_exchange][token] -= quantity
+	exchange_balances[c.Ask_exchange][quote] -= cost
+
+}
+
+// sell leg of an inventory trade has filled
+// move on to watching the buy leg, placing it if it failed before
+func resume_inventory_buy(t utils.Transaction) {
+
+	if t.Buy_tx_id == "" {
+		place_buy_order(t.ID.Hex(), t.Status, transaction_pair(t), t.Buy_exchange, t.Buy_price, t.Buy_quantity)
+		return
+	}
+
+	mongo.Buy_order_placed(t.ID.Hex(), t.Status, t.Buy_tx_id, t.Buy_quantity, t.Buy_price)
+
+}
@@ -3,15 +3,27 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	// common exchange interface and registry
+	"./exchanges"
+
 	// individual exchange packages
 	"./exchanges/binance"
+	"./exchanges/bittrex"
 	"./exchanges/bitz"
 	"./exchanges/kucoin"
 	"./exchanges/okex"
+	"./exchanges/poloniex"
+
+	// simulated exchange for paper trading
+	"./exchanges/paper"
 
 	// database package
 	"./db/mongo"
@@ -36,6 +48,11 @@ var props = make(map[string]string)
 // each key is a token symbol, ie REQ, LINK, etc
 var tokens = make(map[string]bool)
 
+// currencies tokens are priced and traded in, same map structure
+// each token is compared separately on every quote market
+// ex: ["ETH"] = true, ["BTC"] = true
+var quotes = make(map[string]bool)
+
 // started with holding exchange prices in individual variables
 // but as we add more exchanges it becomes a hassle to pass around
 // all those variables, so let's hold them in one map
@@ -45,6 +62,14 @@ var exchange_prices = make(map[string]map[string]float64)
 // same story and structure as exchange_prices above
 var exchange_balances = make(map[string]map[string]float64)
 
+// gocron runs every job in its own goroutine, jobs that share
+// the maps above take turns on them instead of racing
+var jobs_mutex sync.Mutex
+
+// order books of markets we actively trade
+// ex: ["binance"]["NULS-ETH"] = {Bids: [...], Asks: [...]}
+var order_books = make(map[string]map[string]utils.Order_book)
+
 // same story and structure as exchange_prices above
 var listed_tokens = make(map[string][]string)
 
@@ -52,13 +77,55 @@ var listed_tokens = make(map[string][]string)
 // each value is the number of tokens to be sold at once per trade
 var trade_quantity = make(map[string]int)
 
-// comparisons are stored per token
-// Ex: ["NULS"] = {"Min_price" : 0.04, ...}
+// comparisons are stored per market
+// Ex: ["NULS-ETH"] = {"Min_price" : 0.04, ...}
 var comparisons = make(map[string]utils.Comparison)
 
-// currently limited to holding ETH fee
-// charged by each exchange upon withdrawal
-var fees = make(map[string]float64)
+// withdrawal fees charged by each exchange, per asset
+// ex: ["binance"]["ETH"] = 0.01
+var fees = make(map[string]map[string]float64)
+
+// percent taken by each exchange on every filled order
+// ex: ["binance"] = 0.1
+var trade_fees = make(map[string]float64)
+
+// "transfer" sells, moves the quote over and buys with it
+// "inventory" sells and buys at once from balances held on both sides
+var strategy string
+
+// minutes between rebalancing runs, 0 turns it off
+// and how far, in percent points, an exchange's share of an asset
+// may drift from its target before funds are moved
+var rebalance_interval int
+var rebalance_drift float64
+
+// minutes between sweeps of profit to TREZOR_ETH, 0 turns it off
+var sweep_interval int
+
+// triangular arbitrage within single exchanges, off without a threshold
+// threshold is the percent a cycle must gain after fees to be reported
+// and executing places its legs instead of only reporting them
+var triangular bool
+var triangular_execute bool
+var triangular_threshold float64
+
+// limit orders left unfilled for longer than max age are cancelled
+// "reprice" places them again at the current price, while it's profitable
+// "cancel" cancels the transaction, nothing is reversed, funds from
+// steps already done are left where they are, ie the quote sitting on
+// the buy exchange after a transfer, for someone to move by hand
+var order_max_age time.Duration
+var order_timeout_policy string
+
+// whether transactions already in flight keep moving
+// while flags halt new ones, HALT_RESUME_TRANSACTIONS
+var halt_resume bool
+
+// net profit a trade must be expected to make, after all fees
+// both in absolute quote, per quote, and as percent of what is being sold
+// ex: ["ETH"] = 0.01 from MIN_PROFIT_ETH
+var min_profit = make(map[string]float64)
+var min_profit_percent float64
 
 // percentage threshold is the difference between min and max price
 // required for us to profit from running arbitrage
@@ -67,7 +134,43 @@ var percent_threshold float64
 // threshold for writing a message to discord
 var discord_percent_threshold float64
 
-func init() {
+// paper trading sends orders and transfers to a simulated exchange
+// while prices still come from exchanges or the prices collection
+var paper_trading bool
+var paper_recorded bool
+
+// every exchange adapter the bot knows how to talk to
+// only the ones listed under EXCHANGES in .env get initialized
+var adapters = map[string]func() exchanges.Exchange{
+	"binance": func() exchanges.Exchange {
+		binance.Initialize(props["BINANCE_URL"], props["BINANCE_KEY"], props["BINANCE_SECRET"], props["BINANCE_ETH_FEE"])
+		return binance.Adapter{}
+	},
+	"kucoin": func() exchanges.Exchange {
+		kucoin.Initialize(props["KUCOIN_URL"], props["KUCOIN_KEY"], props["KUCOIN_SECRET"], props["KUCOIN_ETH_FEE"])
+		return kucoin.Adapter{}
+	},
+	"bittrex": func() exchanges.Exchange {
+		bittrex.Initialize(props["BITTREX_URL"], props["BITTREX_KEY"], props["BITTREX_SECRET"], props["BITTREX_ETH_FEE"])
+		return bittrex.Adapter{}
+	},
+	"bitz": func() exchanges.Exchange {
+		bitz.Initialize(props["BITZ_URL"], props["BITZ_KEY"], props["BITZ_SECRET"], props["BITZ_TRADEPW"], props["BITZ_ETH_FEE"])
+		return bitz.Adapter{}
+	},
+	"okex": func() exchanges.Exchange {
+		okex.Initialize(props["OKEX_URL"], props["OKEX_KEY"], props["OKEX_SECRET"], props["OKEX_TRADEPW"], props["OKEX_ETH_FEE"])
+		return okex.Adapter{}
+	},
+	"poloniex": func() exchanges.Exchange {
+		poloniex.Initialize(props["POLONIEX_URL"], props["POLONIEX_KEY"], props["POLONIEX_SECRET"], props["POLONIEX_ETH_FEE"])
+		return poloniex.Adapter{}
+	},
+}
+
+// reads .env and connects the database, exchanges and discord,
+// run from main rather than init so tests can load the package
+func setup() {
 
 	fmt.Println("initializing main package")
 
@@ -84,28 +187,31 @@ func init() {
 
 			if split[0] == "TOKENS" {
 
-				no_spaces := strings.Replace(split[1], " ", "", -1)
-				pairs := strings.Split(no_spaces, ",")
+				parse_tokens(split[1])
 
-				// parse tokens and trade quantities
-				for _, pair := range pairs {
-					temp := strings.Split(pair, ":")
-					quantity, _ := strconv.Atoi(temp[1])
+			} else if split[0] == "QUOTES" {
 
-					// tokens with trade quantity of 0
-					// won't be traded, but will be tracked
-					tokens[temp[0]] = true
-					trade_quantity[temp[0]] = quantity
-				}
+				parse_quotes(split[1])
 
 			} else if strings.HasSuffix(split[0], "_FEE") {
 
-				exchange := strings.Split(split[0], "_")[0]
-				exchange = strings.ToLower(exchange)
+				// ex: BINANCE_ETH_FEE or BINANCE_TRADE_FEE
+				parts := strings.Split(split[0], "_")
+				exchange := strings.ToLower(parts[0])
 				fee, err := strconv.ParseFloat(split[1], 64)
 				utils.Check(err)
 
-				fees[exchange] = fee
+				if parts[1] == "TRADE" {
+					trade_fees[exchange] = fee
+				} else {
+					if fees[exchange] == nil {
+						fees[exchange] = make(map[string]float64)
+					}
+					fees[exchange][parts[1]] = fee
+				}
+
+				// exchange packages take their ETH fee on initialization
+				props[split[0]] = split[1]
 
 			} else {
 
@@ -123,43 +229,183 @@ func init() {
 	discord_percent_threshold, err = strconv.ParseFloat(props["DISCORD_PERCENT_THRESHOLD"], 64)
 	utils.Check(err)
 
+	// ETH is the original and default quote
+	if len(quotes) == 0 {
+		quotes["ETH"] = true
+	}
+
+	for quote := range quotes {
+
+		if props["MIN_PROFIT_"+quote] == "" {
+			continue
+		}
+
+		min_profit[quote], err = strconv.ParseFloat(props["MIN_PROFIT_"+quote], 64)
+		utils.Check(err)
+
+	}
+
+	min_profit_percent, err = strconv.ParseFloat(props["MIN_PROFIT_PERCENT"], 64)
+	utils.Check(err)
+
+	strategy = props["STRATEGY"]
+
+	if props["REBALANCE_INTERVAL"] != "" {
+
+		rebalance_interval, err = strconv.Atoi(props["REBALANCE_INTERVAL"])
+		utils.Check(err)
+
+		rebalance_drift, err = strconv.ParseFloat(props["REBALANCE_DRIFT"], 64)
+		utils.Check(err)
+
+	}
+
+	if strategy == "" {
+		strategy = "transfer"
+	}
+
+	if props["SWEEP_INTERVAL"] != "" {
+
+		sweep_interval, err = strconv.Atoi(props["SWEEP_INTERVAL"])
+		utils.Check(err)
+
+	}
+
+	if props["TRIANGULAR_THRESHOLD"] != "" {
+
+		triangular = true
+		triangular_execute = props["TRIANGULAR_EXECUTE"] == "true"
+
+		triangular_threshold, err = strconv.ParseFloat(props["TRIANGULAR_THRESHOLD"], 64)
+		utils.Check(err)
+
+	}
+
+	if props["ORDER_MAX_AGE"] != "" {
+
+		minutes, err := strconv.Atoi(props["ORDER_MAX_AGE"])
+		utils.Check(err)
+
+		order_max_age = time.Duration(minutes) * time.Minute
+		order_timeout_policy = props["ORDER_TIMEOUT_POLICY"]
+
+	}
+
+	if order_timeout_policy == "" {
+		order_timeout_policy = "reprice"
+	}
+
+	halt_resume = props["HALT_RESUME_TRANSACTIONS"] != "false"
+
+	utils.Workers = int(prop_float("FETCH_WORKERS", float64(utils.Workers)))
+
+	utils.Request_timeout = time.Duration(prop_float("REQUEST_TIMEOUT", 20) * float64(time.Second))
+
 	// initialize database connection
 	mongo.Initialize(props["HOST"], props["DATABASE"], props["USERNAME"], props["PASSWORD"])
 
-	// initialize exchange packages
-	binance.Initialize(props["BINANCE_URL"], props["BINANCE_KEY"], props["BINANCE_SECRET"], props["BINANCE_ETH_FEE"])
-	kucoin.Initialize(props["KUCOIN_URL"], props["KUCOIN_KEY"], props["KUCOIN_SECRET"], props["KUCOIN_ETH_FEE"])
-	bitz.Initialize(props["BITZ_URL"], props["BITZ_KEY"], props["BITZ_SECRET"], props["BITZ_TRADEPW"], props["BITZ_ETH_FEE"])
-	okex.Initialize(props["OKEX_URL"], props["OKEX_KEY"], props["OKEX_SECRET"], props["OKEX_TRADEPW"], props["OKEX_ETH_FEE"])
+	// deposit addresses withdrawals may go to
+	load_address_book()
+
+	// initialize paper trading simulator, if enabled
+	paper_trading = props["PAPER_TRADING"] == "true"
+
+	if paper_trading {
+		initialize_paper_trading()
+	}
+
+	// initialize and register enabled exchange packages
+	for _, name := range strings.Split(strings.Replace(props["EXCHANGES"], " ", "", -1), ",") {
+
+		name = strings.ToLower(name)
+
+		if name == "" {
+			continue
+		}
+
+		adapter, ok := adapters[name]
+
+		if !ok {
+			panic("Unknown exchange in EXCHANGES: " + name)
+		}
+
+		exchange := adapter()
+
+		if paper_recorded {
+			exchange = paper.Adapter{Name: name, Quoter: paper.Recorded{Exchange: name}}
+		} else if paper_trading {
+			exchange = paper.Adapter{Name: name, Quoter: exchange}
+		}
+
+		exchanges.Register(name, exchange)
+		utils.Rate_limit(name, prop_float(strings.ToUpper(name)+"_RATE_LIMIT", 0))
+
+	}
 
 	// initialize discord bot
-	discord.Initialize(props["DISCORD_AUTH_TOKEN"], props["DISCORD_BOT_ID"], props["DISCORD_CHANNEL_ID"])
+	var quote_list []string
+
+	for quote := range quotes {
+		quote_list = append(quote_list, quote)
+	}
+
+	sort.Strings(quote_list)
+
+	discord.Initialize(props["DISCORD_AUTH_TOKEN"], props["DISCORD_BOT_ID"], props["DISCORD_CHANNEL_ID"], props["DISCORD_OWNER_ID"], quote_list)
 
 }
 
 func main() {
 
+	setup()
+
+	// one-off commands, ex: ./arbitrage backtest -from "2018-03-01 00:00"
+	if len(os.Args) > 1 && os.Args[1] == "backtest" {
+		backtest(os.Args[2:])
+		return
+	}
+
+	// all jobs share one scheduler, waiting on
+	// more than one would block on the first forever
+	scheduler := gocron.NewScheduler()
+
 	// main arbitrage flow
-	arbitrage := gocron.NewScheduler()
-	arbitrage.Every(1).Minutes().Do(run)
-	<-arbitrage.Start()
+	scheduler.Every(1).Minutes().Do(run)
 
 	// once a day update total balance
 	// and post summary to discord
-	daily := gocron.NewScheduler()
-	daily.Every(1).Day().At("20:00").Do(daily)
-	<-daily.Start()
+	scheduler.Every(1).Day().At("20:00").Do(daily)
 
 	// every 3 days, look at all tokens
 	// listed on supported exchanges
-	analyze := gocron.NewScheduler()
-	analyze.Every(3).Day().Do(analyze)
-	<-analyze.Start()
+	scheduler.Every(3).Days().Do(analyze)
+
+	// even out balances left behind by inventory trades
+	if rebalance_interval > 0 {
+		scheduler.Every(uint64(rebalance_interval)).Minutes().Do(rebalance)
+	}
+
+	// move realized profit to the cold wallet
+	if sweep_interval > 0 {
+		scheduler.Every(uint64(sweep_interval)).Minutes().Do(sweep)
+	}
+
+	<-scheduler.Start()
 
 }
 
 func run() {
 
+	jobs_mutex.Lock()
+	defer jobs_mutex.Unlock()
+
+	//-----------------------------------//
+	// move simulated clock along
+	//-----------------------------------//
+	if paper_trading {
+		paper.Tick()
+	}
+
 	//-----------------------------------//
 	// check for flags that kill bot
 	// for safety reasons, ie bad transaction
@@ -176,20 +422,34 @@ func run() {
 	combined_tokens := combine_personal_and_discord_tokens(tokens, discord_tokens)
 
 	//-----------------------------------//
-	// get prices from all exchanges
+	// get prices and balances from all exchanges at once
+	// including markets between quotes, ie ETH-BTC
 	//-----------------------------------//
-	exchange_prices["binance"] = binance.Get_price(combined_tokens)
-	exchange_prices["kucoin"] = kucoin.Get_price(combined_tokens)
-	// exchange_prices["bitz"] = bitz.Get_price(combined_tokens)
-	exchange_prices["okex"] = okex.Get_price(combined_tokens)
+	snapshot := fetch_snapshot(with_quotes(combined_tokens))
+
+	for _, name := range exchanges.Names() {
+		exchange_prices[name] = snapshot.Prices[name]
+		exchange_tickers[name] = snapshot.Tickers[name]
+		exchange_balances[name] = snapshot.Balances[name]
+	}
 
 	//-----------------------------------//
-	// get balances from all exchanges
+	// trip circuit breakers of misbehaving exchanges
+	// replayed prices have no api behind them
 	//-----------------------------------//
-	exchange_balances["binance"] = binance.Get_balances(combined_tokens)
-	exchange_balances["kucoin"] = kucoin.Get_balances(combined_tokens)
-	// exchange_balances["bitz"] = bitz.Get_balances(combined_tokens)
-	exchange_balances["okex"] = okex.Get_balances(combined_tokens)
+	if !paper_recorded {
+		check_breakers(exchange_prices)
+	}
+
+	//-----------------------------------//
+	// leave out stale, thin and outlying prices
+	//-----------------------------------//
+	exchange_prices = validate_prices(exchange_prices)
+
+	//-----------------------------------//
+	// get order books for traded markets
+	//-----------------------------------//
+	get_order_books(live_prices(exchange_prices))
 
 	//-----------------------------------//
 	// exclude tokens that have available balance
@@ -200,13 +460,32 @@ func run() {
 	//-----------------------------------//
 	// start new transactions
 	//-----------------------------------//
-	compare_prices(exchange_prices, exclude)
+	compare_prices(live_prices(exchange_prices), exclude)
+
+	//-----------------------------------//
+	// cycles within a single exchange
+	//-----------------------------------//
+	if triangular {
+		resolve_triangles()
+	}
 
 	//-----------------------------------//
 	// get incomplete transactions
 	//-----------------------------------//
 	resume_transactions(mongo.Get_incomplete_transactions())
 
+	//-----------------------------------//
+	// write completed transactions to the ledger
+	//-----------------------------------//
+	record_ledger()
+
+	//-----------------------------------//
+	// check on rebalancing transfers
+	//-----------------------------------//
+	if rebalance_interval > 0 {
+		track_rebalances()
+	}
+
 	//-----------------------------------//
 	// save comparisons
 	//-----------------------------------//
@@ -214,24 +493,50 @@ func run() {
 
 	//-----------------------------------//
 	// save prices from all exchanges
+	// replayed prices are already stored
 	//-----------------------------------//
-	mongo.Save_prices(exchange_prices)
+	if !paper_recorded {
+		mongo.Save_prices(exchange_prices)
+	}
 
 }
 
 func analyze() {
 
+	jobs_mutex.Lock()
+	defer jobs_mutex.Unlock()
+
 	unique := make(map[string][]string)
 
-	listed_tokens["binance"] = binance.Get_listed_tokens()
-	listed_tokens["kucoin"] = kucoin.Get_listed_tokens()
-	listed_tokens["bitz"] = bitz.Get_listed_tokens()
+	var collected [][]string
+
+	for _, name := range exchanges.Names() {
+
+		exchange, _ := exchanges.Get(name)
+
+		if _, ok := exchange.(exchanges.Searcher); ok {
+			continue
+		}
+
+		listed_tokens[name] = exchange.Get_listed_tokens(quotes)
+		collected = append(collected, listed_tokens[name])
+
+	}
 
 	// OKEX has no convenient way of getting a list of all listed tokens
 	// thus, we have to pass everything we collected thus far
 	// and look up each token one by one
-	combo := utils.Merge_uniques(listed_tokens["binance"], listed_tokens["kucoin"], listed_tokens["bitz"])
-	listed_tokens["okex"] = okex.Get_listed_tokens(combo)
+	combo := utils.Merge_uniques(collected...)
+
+	for _, name := range exchanges.Names() {
+
+		exchange, _ := exchanges.Get(name)
+
+		if searcher, ok := exchange.(exchanges.Searcher); ok {
+			listed_tokens[name] = searcher.Search_listed_tokens(combo, quotes)
+		}
+
+	}
 
 	// format for storage
 	for exchange, tokens := range listed_tokens {
@@ -248,6 +553,70 @@ func analyze() {
 
 }
 
+// parses TOKENS value into tokens and trade_quantity
+// ex: NULS:100,LINK:0
+func parse_tokens(value string) {
+
+	no_spaces := strings.Replace(value, " ", "", -1)
+	pairs := strings.Split(no_spaces, ",")
+
+	// parse tokens and trade quantities
+	for _, pair := range pairs {
+		temp := strings.Split(pair, ":")
+		quantity, _ := strconv.Atoi(temp[1])
+
+		// tokens with trade quantity of 0
+		// won't be traded, but will be tracked
+		tokens[temp[0]] = true
+		trade_quantity[temp[0]] = quantity
+	}
+
+}
+
+// parses QUOTES value into quotes
+// ex: ETH,BTC,USDT
+func parse_quotes(value string) {
+
+	no_spaces := strings.Replace(value, " ", "", -1)
+
+	for _, quote := range strings.Split(no_spaces, ",") {
+		if quote != "" {
+			quotes[strings.ToUpper(quote)] = true
+		}
+	}
+
+}
+
+// balances are also needed for the quotes themselves
+// which aren't among the tokens we compare
+func with_quotes(tokens map[string]bool) map[string]bool {
+
+	var copied = make(map[string]bool)
+
+	for k, v := range tokens {
+		copied[k] = v
+	}
+
+	for quote := range quotes {
+		copied[quote] = true
+	}
+
+	return copied
+
+}
+
+// transactions recorded before other quotes
+// were supported have none and are all ETH
+func transaction_pair(t utils.Transaction) string {
+
+	if t.Quote == "" {
+		return utils.Pair(t.Token, "ETH")
+	}
+
+	return utils.Pair(t.Token, t.Quote)
+
+}
+
 func combine_personal_and_discord_tokens(tokens map[string]bool, discord_tokens []string) map[string]bool {
 
 	var combined_tokens = make(map[string]bool)
@@ -309,217 +678,260 @@ func resume_transactions(transactions []utils.Transaction) {
 
 	for _, t := range transactions {
 
+		// halted transactions are left where they are
+		// unless they're allowed to run to a safe state
+		if !halt_resume && is_halted(t.Token, t.Sell_exchange, t.Buy_exchange) {
+			continue
+		}
+
+		pair := transaction_pair(t)
+		quote := utils.Pair_quote(pair)
+
+		// markets the orders are actually placed on
+		sell_pair := pair
+		buy_pair := pair
+
+		if t.Sell_via != "" {
+			sell_pair = utils.Pair(t.Token, t.Sell_via)
+		}
+
+		if t.Buy_via != "" {
+			buy_pair = utils.Pair(t.Token, t.Buy_via)
+		}
+
 		switch t.Status {
 
 		case utils.SellPlaced:
-			check_if_sold(t.ID.Hex(), t.Token, t.Sell_exchange, t.Sell_tx_id)
+			if !check_if_sold(t.ID.Hex(), sell_pair, t.Sell_exchange, t.Sell_tx_id) && order_expired(t) {
+				expire_order(t, "sell", sell_pair)
+			}
 
 		case utils.SellCompleted:
-			buy_exchange := comparisons[t.Token].Min_exchange
-			destination := props[strings.ToUpper(buy_exchange)+"_ETH_ADDRESS"]
-			buy_price := comparisons[t.Token].Min_price
+			// inventory trades placed their buy along with the sell
+			if t.Strategy == "inventory" {
+				resume_inventory_buy(t)
+				continue
+			}
+
+			// synthetic sells are converted to the quote before moving it
+			if t.Sell_via != "" && !t.Sell_conversion.Filled {
+
+				leg, converted := convert(t, "sell", t.Sell_exchange, t.Sell_via, quote, t.Sell_conversion, t.Sell_cost)
+
+				if converted {
+					mongo.Sell_cost_converted(t.ID.Hex(), converted_amount(t.Sell_exchange, leg))
+				}
+
+				continue
+			}
+
+			buy_exchange := comparisons[pair].Ask_exchange
+			destination := deposit_address(buy_exchange, quote)
+			buy_price := comparisons[pair].Ask_vwap
 
 			// time has passed since the sale was first placed
 			// it has been fulfilled, but the prices may have changed
 			// enough for us to lose the % difference required to profit
-			comparison := comparisons[t.Token]
+			comparison := comparisons[pair]
 
-			// check if difference is over the thershold
-			// if so, trigger the sell
-			if comparison.Difference >= percent_threshold {
-				start_transfer(t.ID.Hex(), "ETH", t.Sell_exchange, buy_exchange, destination, t.Sell_cost, buy_price)
+			// check if executable difference is over the thershold
+			// and cheapest asks are somewhere we can transfer to
+			if comparison.Ask_vwap > 0 && buy_exchange != t.Sell_exchange && comparison.Executable_difference >= percent_threshold && is_profitable(comparison) {
+				start_transfer(t.ID.Hex(), quote, t.Sell_exchange, buy_exchange, comparison.Ask_via, destination, t.Sell_cost, buy_price)
 			}
 
 		case utils.TransferStarted:
-			check_if_transferred(t.ID.Hex(), t.Buy_exchange, t.Sell_cost)
+			check_if_transferred(t, quote)
 
 		case utils.TransferCompleted:
 
-			token := strings.ToUpper(t.Token + "-ETH")
-			buy_price := exchange_prices[t.Buy_exchange][token]
-			quantity := t.Sell_cost / buy_price
-
-			// if we're about to place a buy order
-			// for a less than profitable amount of tokens
-			// throw error and kill bot
-			// 4 is an arbitrary number for now, should be revisited
-			if quantity < float64(trade_quantity[t.Token]+4) {
-				throw_flag()
-			}
+			// what arrived, the withdrawal fee stayed behind
+			spend := t.Sell_cost - fees[t.Sell_exchange][quote]
 
-			place_buy_order(t.ID.Hex(), t.Token, t.Buy_exchange, buy_price, quantity)
+			// synthetic buys convert what arrived first
+			if t.Buy_via != "" {
 
-		case utils.BuyPlaced:
-			check_if_bought(t.ID.Hex(), t.Token, t.Buy_exchange, t.Sell_exchange, t.Buy_tx_id)
+				if !t.Buy_conversion.Filled {
+					convert(t, "buy", t.Buy_exchange, quote, t.Buy_via, t.Buy_conversion, spend)
+					continue
+				}
 
-		case utils.BuyCompleted:
-			exchange := strings.ToUpper(t.Sell_exchange)
-			destination := props[exchange+"_ETH_ADDRESS"]
-			// the fee is arbitrary for now but needs to be smarter
-			amount := float64(trade_quantity[t.Token] + 4)
+				spend = converted_amount(t.Buy_exchange, t.Buy_conversion)
 
-			reset(t.Token, t.Buy_exchange, destination, t.ID.Hex(), amount)
-
-		default:
-			panic("Invalid transaction status.")
+			}
 
-		}
+			buy_price := exchange_prices[t.Buy_exchange][buy_pair]
 
-	}
+			// price what we can actually buy with the quote we have
+			// walking the asks instead of trusting the last trade
+			if book := order_books[t.Buy_exchange][buy_pair]; len(book.Asks) > 0 {
+				if vwap, ok := utils.Vwap(book.Asks, spend/book.Asks[0].Price); ok {
+					buy_price = vwap
+				}
+			}
 
-}
+			quantity := spend / buy_price
 
-func check_if_sold(row_id, token, sell_exchange, sell_tx_id string) {
+			// if we're about to place a buy order
+			// for less tokens than were actually sold
+			// halt the token until someone looks at it
+			// the quote is left where it is on the buy exchange
+			if quantity < t.Sell_quantity+token_withdrawal_fee(t.Buy_exchange, t.Token) {
+				throw_flag(utils.Halt, "token", t.Token, "Buying less than profitable quantity.")
+				mongo.Transaction_failed(t.ID.Hex(), t.Status, fmt.Sprintf("buying %f %s is less than the %f sold", quantity, t.Token, t.Sell_quantity))
+				continue
+			}
 
-	amount := 0.0
-	sold := false
+			place_buy_order(t.ID.Hex(), t.Status, buy_pair, t.Buy_exchange, buy_price, quantity)
 
-	switch sell_exchange {
+		case utils.BuyPlaced:
+			if !check_if_bought(t.ID.Hex(), buy_pair, t.Buy_exchange, t.Sell_exchange, t.Buy_tx_id) && order_expired(t) {
+				expire_order(t, "buy", buy_pair)
+			}
 
-	case "binance":
-		amount, sold = binance.Check_if_sold(token, sell_tx_id)
+		case utils.BuyCompleted:
+			// inventory trades are rebalanced separately
+			if t.Strategy == "inventory" {
+				mongo.Token_reset_completed(t.ID.Hex(), "")
+				continue
+			}
 
-	case "kucoin":
-		amount, sold = kucoin.Check_if_sold(token, sell_tx_id)
+			// tokens go to their own deposit address, ERC20 tokens
+			// without one share the exchange's ETH address
+			destination := deposit_address(t.Sell_exchange, t.Token)
 
-	case "bitz":
-		amount, sold = bitz.Check_if_sold(token, sell_tx_id)
+			// send back enough for what was sold to arrive
+			// never more than the buy actually filled
+			amount := math.Min(t.Sell_quantity+token_withdrawal_fee(t.Buy_exchange, t.Token), t.Buy_quantity)
 
-	case "okex":
-		amount, sold = okex.Check_if_sold(token, sell_tx_id)
+			reset(t.Token, t.Buy_exchange, destination, t.ID.Hex(), amount)
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+		// fails the one transaction instead of the whole bot
+		default:
+			mongo.Transaction_failed(t.ID.Hex(), t.Status, fmt.Sprintf("invalid transaction status %d", t.Status))
 
-	}
+		}
 
-	if sold {
-		mongo.Sell_order_completed(row_id, sell_exchange, amount)
 	}
 
 }
 
-func start_transfer(row_id, token, sell_exchange, buy_exchange, destination string, amount, buy_price float64) {
+func check_if_sold(row_id, pair, sell_exchange, sell_tx_id string) bool {
 
-	tx_id := ""
-	started := false
+	exchange, ok := get_exchange(sell_exchange)
 
-	switch sell_exchange {
+	if !ok {
+		return false
+	}
 
-	case "binance":
-		tx_id, started = binance.Start_transfer(token, destination, amount)
+	// partially filled orders are waited on while they're open
+	order := exchange.Get_order(pair, "sell", sell_tx_id)
 
-	case "kucoin":
-		tx_id, started = kucoin.Start_transfer(token, destination, amount)
+	if order.Done() {
+		mongo.Sell_order_completed(row_id, order)
+	}
 
-	case "bitz":
-		tx_id, started = bitz.Start_transfer(token, destination, amount)
+	return order.Done()
 
-	case "okex":
-		tx_id, started = okex.Start_transfer(token, destination, amount)
+}
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+func start_transfer(row_id, token, sell_exchange, buy_exchange, buy_via, destination string, amount, buy_price float64) {
 
-	}
+	tx_id, started := withdraw(sell_exchange, token, destination, amount)
 
 	if started {
-		mongo.Transfer_started(row_id, tx_id, buy_exchange, buy_price)
+		mongo.Transfer_started(row_id, tx_id, buy_exchange, buy_via, buy_price)
 	}
 
 }
 
-func check_if_transferred(row_id, buy_exchange string, sell_cost float64) {
-
-	transferred := false
-	sell_cost = utils.ToFixed(sell_cost-fees[buy_exchange], 4)
+func check_if_transferred(t utils.Transaction, quote string) {
 
-	switch buy_exchange {
+	row_id := t.ID.Hex()
+	exchange, ok := get_exchange(t.Buy_exchange)
 
-	case "binance":
-		transferred = binance.Check_if_transferred(sell_cost)
+	if !ok {
+		return
+	}
 
-	case "kucoin":
-		transferred = kucoin.Check_if_transferred(sell_cost)
+	// the chain txid shows up on the withdrawal some time after it's sent
+	// until then deposits are matched on amount alone
+	txid := t.Transfer_txid
 
-	case "bitz":
-		transferred = bitz.Check_if_transferred(sell_cost)
+	if txid == "" {
 
-	case "okex":
-		transferred = okex.Check_if_transferred(sell_cost)
+		txid = withdrawal_txid(t.Sell_exchange, quote, t.Transfer_id)
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+		if txid != "" {
+			mongo.Transfer_txid_resolved(row_id, txid)
+		}
 
 	}
 
+	// withdrawal fee is charged by the exchange we withdrew from
+	arrived := t.Sell_cost - fees[t.Sell_exchange][quote]
+
+	// only deposits since the transfer started, that no other
+	// transaction or rebalance has been matched to already
+	deposit_id, transferred := exchange.Check_if_transferred(quote, txid, arrived, placed_at(t), mongo.Get_matched_deposits(t.Buy_exchange))
+
 	if transferred {
-		mongo.Transfer_completed(row_id)
+		mongo.Transfer_completed(row_id, deposit_id)
 	}
 
 }
 
-func place_buy_order(row_id, token, buy_exchange string, buy_price, quantity float64) {
+// looks up the chain txid of a withdrawal started on an exchange
+// empty while it hasn't been sent yet, or the exchange can't tell
+func withdrawal_txid(name, asset, withdrawal_id string) string {
 
-	tx_id := ""
-	placed := false
+	exchange, ok := get_exchange(name)
 
-	switch buy_exchange {
+	if !ok || withdrawal_id == "" {
+		return ""
+	}
 
-	case "binance":
-		tx_id, placed = binance.Place_buy_order(token, quantity, buy_price)
+	txid, found := exchange.Get_withdrawal_txid(asset, withdrawal_id)
 
-	case "kucoin":
-		tx_id, placed = kucoin.Place_buy_order(token, quantity, buy_price)
+	if !found {
+		return ""
+	}
 
-	case "bitz":
-		tx_id, placed = bitz.Place_buy_order(token, quantity, buy_price)
+	return txid
 
-	case "okex":
-		tx_id, placed = okex.Place_buy_order(token, quantity, buy_price)
+}
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+func place_buy_order(row_id string, from utils.Status, pair, buy_exchange string, buy_price, quantity float64) {
 
-	}
+	// buys finish a trade whose sell already filled
+	tx_id, placed := place_order(buy_exchange, "buy", pair, quantity, buy_price, true)
 
 	if placed {
-		mongo.Buy_order_placed(row_id, tx_id, quantity, buy_price)
+		mongo.Buy_order_placed(row_id, from, tx_id, quantity, buy_price)
 	}
 
 }
 
-func check_if_bought(row_id, token, buy_exchange, sell_exchange, buy_tx_id string) {
-
-	bought := false
-
-	switch buy_exchange {
-
-	case "binance":
-		bought = binance.Check_if_bought(token, buy_tx_id)
-
-	case "kucoin":
-		bought = kucoin.Check_if_bought(token, buy_tx_id)
+func check_if_bought(row_id, pair, buy_exchange, sell_exchange, buy_tx_id string) bool {
 
-	case "bitz":
-		bought = bitz.Check_if_bought(token, buy_tx_id)
+	exchange, ok := get_exchange(buy_exchange)
 
-	case "okex":
-		bought = okex.Check_if_bought(token, buy_tx_id)
+	if !ok {
+		return false
+	}
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+	order := exchange.Get_order(pair, "buy", buy_tx_id)
 
+	if order.Done() {
+		mongo.Buy_order_completed(row_id, order)
 	}
 
-	if bought {
-		mongo.Buy_order_completed(row_id)
-	}
+	return order.Done()
 
 }
 
-// starting point, loops over all tokens
-// uses find_min_max_exchanges() on each token
+// starting point, loops over all tokens on every quote
+// uses find_min_max_exchanges() on each market
 // if there is sufficient price gap, begins a transaction with sell()
 func compare_prices(exchange_prices map[string]map[string]float64, exclude map[string]bool) {
 
@@ -527,58 +939,78 @@ func compare_prices(exchange_prices map[string]map[string]float64, exclude map[s
 	// messages := make(map[string]string, len(tokens)-len(exclude))
 
 	for token := range tokens {
+		for quote := range quotes {
+
+			pair := utils.Pair(token, quote)
+			quantity := float64(trade_quantity[token])
+			prices, vias := synthetic_prices(token, quote, filter_prices(pair, exchange_prices))
+			books := synthetic_order_books(token, quote, filter_order_books(pair, order_books), vias)
+
+			comparison := find_min_max_exchanges(prices)
+			comparison.Token = token
+			comparison.Quote = quote
+			comparison = find_executable_prices(comparison, books, quantity)
+			comparison.Rejected = rejected_prices[pair]
+			comparison.Bid_via = vias[comparison.Bid_exchange]
+			comparison.Ask_via = vias[comparison.Ask_exchange]
+			comparison = estimate_net_profit(comparison, token, quantity)
+			comparisons[pair] = comparison
+
+			if !backtesting {
+				fmt.Println(pair, comparison, "Difference:", comparison.Difference, "%")
+			}
 
-		prices := filter_prices(token, exchange_prices)
-
-		comparison := find_min_max_exchanges(prices)
-		comparisons[token] = comparison
-
-		fmt.Println(token, comparison, "Difference:", comparison.Difference, "%")
+			// comparisons are used for personal needs and discord subscribers
+			// however, here we can skip the rest of the process
+			//  if a token us not used for personal trading
+			if exclude[token] {
+				continue
+			}
 
-		// comparisons are used for personal needs and discord subscribers
-		// however, here we can skip the rest of the process
-		//  if a token us not used for personal trading
-		if exclude[token] {
-			continue
-		}
+			// check if executable difference is over the thershold
+			// and what's left after fees is worth the trouble
+			// if so, trigger the sell into the bids
+			if comparison.Bid_vwap > 0 && comparison.Executable_difference >= percent_threshold && is_profitable(comparison) {
 
-		// check if difference is over the thershold
-		// if so, trigger the sell
-		if comparison.Difference >= percent_threshold {
+				// inventory trades are placed on direct markets only
+				if strategy == "inventory" && comparison.Bid_via == "" && comparison.Ask_via == "" {
+					place_inventory_orders(pair, comparison)
+				} else if strategy != "inventory" {
+					place_sell_order(pair, comparison.Bid_via, comparison.Bid_exchange, comparison.Bid_vwap)
+				}
 
-			place_sell_order(token, comparison.Max_exchange, comparison.Max_price)
+			}
 
-		}
+			// separate check for discord notifications
+			if comparison.Difference >= discord_percent_threshold {
 
-		// separate check for discord notifications
-		if comparison.Difference >= discord_percent_threshold {
+				string_diff := strconv.FormatFloat(comparison.Difference, 'f', 0, 64)
+				message := token + " " + string_diff + "% difference between "
+				message += comparison.Min_exchange + "(min) and " + comparison.Max_exchange + "(max)" + " on " + quote + " pair"
+				// messages[token] = message
 
-			string_diff := strconv.FormatFloat(comparison.Difference, 'f', 0, 64)
-			message := token + " " + string_diff + "% difference between "
-			message += comparison.Min_exchange + "(min) and " + comparison.Max_exchange + "(max)" + " on ETH pair"
-			// messages[token] = message
+			}
 
 		}
-
 	}
 
 	// this is a pesonal method, notify me
 	// discord.Send_messages(messages)
 
 	// notify discord subscribers
-	discord.Notify_discorders(comparisons)
+	if !backtesting {
+		discord.Notify_discorders(comparisons)
+	}
 
 }
 
 // because not all tokens are available on all exchanges
 // when we prepare token prices for comparison
 // we need to make sure that we have an actual price, more than 0
-func filter_prices(token string, exchange_prices map[string]map[string]float64) map[string]float64 {
+func filter_prices(pair string, exchange_prices map[string]map[string]float64) map[string]float64 {
 
 	prices := make(map[string]float64)
 
-	pair := token + "-ETH"
-
 	for exchange, tokens := range exchange_prices {
 
 		if tokens[pair] > 0 {
@@ -591,7 +1023,7 @@ func filter_prices(token string, exchange_prices map[string]map[string]float64)
 
 }
 
-// accepts a list of prices for 1 token
+// accepts a list of prices for 1 market
 // fints the minimum and maximum price
 // as well as which exchange they're on
 func find_min_max_exchanges(prices map[string]float64) utils.Comparison {
@@ -631,33 +1063,106 @@ func find_min_max_exchanges(prices map[string]float64) utils.Comparison {
 
 }
 
-// start transaction, selling high
-func place_sell_order(token, exchange string, price float64) {
+// fetches order books of actively traded markets
+// from every exchange that has a price for them
+func get_order_books(exchange_prices map[string]map[string]float64) {
+
+	for _, name := range exchanges.Names() {
 
-	sell_placed := false
-	transaction_id := ""
+		exchange, _ := exchanges.Get(name)
+		books := make(map[string]utils.Order_book)
 
-	switch exchange {
+		for token := range tokens {
+			for quote := range quotes {
 
-	case "binance":
-		transaction_id, sell_placed = binance.Place_sell_order(token, trade_quantity[token], price)
+				pair := utils.Pair(token, quote)
 
-	case "kucoin":
-		transaction_id, sell_placed = kucoin.Place_sell_order(token, trade_quantity[token], price)
+				if trade_quantity[token] > 0 && exchange_prices[name][pair] > 0 {
+					books[pair] = exchange.Get_order_book(pair)
+				}
 
-	case "bitz":
-		transaction_id, sell_placed = bitz.Place_sell_order(token, trade_quantity[token], price)
+			}
+		}
 
-	case "okex":
-		transaction_id, sell_placed = okex.Place_sell_order(token, trade_quantity[token], price)
+		order_books[name] = books
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+	}
+
+}
+
+// same idea as filter_prices, but for order books
+func filter_order_books(pair string, order_books map[string]map[string]utils.Order_book) map[string]utils.Order_book {
+
+	books := make(map[string]utils.Order_book)
+
+	for exchange, markets := range order_books {
+
+		if book, ok := markets[pair]; ok && len(book.Bids) > 0 && len(book.Asks) > 0 {
+			books[exchange] = book
+		}
+
+	}
+
+	return books
+
+}
+
+// a price difference only matters if we can act on it
+// finds the cheapest asks and richest bids for the trade quantity
+// and how far apart they are once the books are walked
+func find_executable_prices(c utils.Comparison, books map[string]utils.Order_book, quantity float64) utils.Comparison {
+
+	for exchange, book := range books {
+
+		ask_vwap, ok := utils.Vwap(book.Asks, quantity)
+
+		if ok && (c.Ask_vwap == 0 || ask_vwap < c.Ask_vwap) {
+			c.Ask_exchange = exchange
+			c.Ask_price = book.Asks[0].Price
+			c.Ask_vwap = ask_vwap
+		}
+
+		bid_vwap, ok := utils.Vwap(book.Bids, quantity)
+
+		if ok && bid_vwap > c.Bid_vwap {
+			c.Bid_exchange = exchange
+			c.Bid_price = book.Bids[0].Price
+			c.Bid_vwap = bid_vwap
+		}
+
+	}
+
+	// buying and selling on the same exchange is no arbitrage
+	if c.Ask_vwap > 0 && c.Bid_vwap > 0 && c.Ask_exchange != c.Bid_exchange {
+		difference := (1 - c.Ask_vwap/c.Bid_vwap) * 100
+		c.Executable_difference = utils.ToFixed(difference, 2)
+	}
+
+	return c
+
+}
+
+// start transaction, selling high
+// synthetic sells go out on the token's market in via
+// at the price converted back from the quote
+func place_sell_order(pair, via, sell_exchange string, price float64) {
+
+	token := utils.Pair_token(pair)
+	market := pair
 
+	if is_halted(token, sell_exchange) || !allow_trade(token) {
+		return
 	}
 
+	if via != "" {
+		market = utils.Pair(token, via)
+		price = price / conversion_rate(sell_exchange, via, utils.Pair_quote(pair))
+	}
+
+	transaction_id, sell_placed := place_order(sell_exchange, "sell", market, float64(trade_quantity[token]), price, false)
+
 	if sell_placed {
-		mongo.Place_sell_order(token, exchange, transaction_id, price)
+		mongo.Place_sell_order(pair, via, sell_exchange, transaction_id, price)
 	}
 
 }
@@ -665,51 +1170,194 @@ func place_sell_order(token, exchange string, price float64) {
 // final step in arbitrage process, send tokens back to origin
 func reset(token, buy_exchange, destination, row_id string, amount float64) {
 
-	is_reset := false
-	transaction_id := ""
+	transaction_id, is_reset := withdraw(buy_exchange, token, destination, amount)
+
+	if is_reset {
+		mongo.Token_reset_completed(row_id, transaction_id)
+	}
+
+}
 
-	switch buy_exchange {
+// numeric prop, or the fallback when it's empty or not a number
+func prop_float(name string, fallback float64) float64 {
 
-	case "binance":
-		transaction_id, is_reset = binance.Start_transfer(token, destination, amount)
+	value, err := strconv.ParseFloat(props[name], 64)
 
-	case "kucoin":
-		transaction_id, is_reset = kucoin.Start_transfer(token, destination, amount)
+	if err != nil {
+		return fallback
+	}
 
-	case "bitz":
-		transaction_id, is_reset = bitz.Start_transfer(token, destination, amount)
+	return value
 
-	case "okex":
-		transaction_id, is_reset = okex.Start_transfer(token, destination, amount)
+}
 
-	default:
-		panic("Exchange selection not provided or doesn't match available choices.")
+// looks up an enabled exchange by name
+// a disabled or unknown exchange is logged instead of killing the bot
+func get_exchange(name string) (exchanges.Exchange, bool) {
+
+	exchange, ok := exchanges.Get(name)
 
+	if !ok {
+		mongo.Log("Exchange " + name + " is not enabled, skipping step.")
 	}
 
-	if is_reset {
-		mongo.Token_reset_completed(row_id, transaction_id)
+	return exchange, ok
+
+}
+
+// reads PAPER_* props and sets up the simulated exchange
+// every address in the address book is used to route simulated transfers
+func initialize_paper_trading() {
+
+	routes := make(map[string]string)
+	starting_balances := make(map[string]float64)
+
+	for exchange, assets := range address_book {
+
+		if exchange == "trezor" {
+			continue
+		}
+
+		for _, address := range assets {
+			routes[address] = exchange
+		}
+
+	}
+
+	// ex: PAPER_BALANCES=ETH:10,NULS:500
+	// each exchange starts out with these balances
+	for _, pair := range strings.Split(strings.Replace(props["PAPER_BALANCES"], " ", "", -1), ",") {
+
+		temp := strings.Split(pair, ":")
+
+		if len(temp) == 2 {
+			amount, err := strconv.ParseFloat(temp[1], 64)
+			utils.Check(err)
+
+			starting_balances[temp[0]] = amount
+		}
+
+	}
+
+	delay, err := strconv.Atoi(props["PAPER_WITHDRAWAL_DELAY"])
+	utils.Check(err)
+
+	paper.Initialize(fees, trade_fees, routes, starting_balances, time.Duration(delay)*time.Minute)
+
+	// profit swept to the cold wallet lands there too
+	if address := deposit_address("trezor", "ETH"); address != "" {
+		paper.Add_wallet(address, "trezor")
+	}
+	mongo.Set_paper_trading(true)
+
+	// replay recorded prices instead of asking exchanges
+	if props["PAPER_REPLAY_FROM"] != "" {
+
+		start, err := time.Parse("2006-01-02 15:04", props["PAPER_REPLAY_FROM"])
+		utils.Check(err)
+
+		paper.Replay_from(start)
+		paper_recorded = true
+
 	}
 
 }
 
+// scopes halted by active flags, refreshed on every run
+// new transactions stay out of them, prices, comparisons
+// and discord notifications carry on as usual
+var halted_global bool
+var halted_tokens = make(map[string]bool)
+var halted_exchanges = make(map[string]bool)
+
 func check_flags(flags []utils.Flag) {
 
-	if len(flags) > 0 {
-		panic("Flag detected, bot execution stalled.")
+	halted_global = false
+	halted_tokens = make(map[string]bool)
+	halted_exchanges = make(map[string]bool)
+
+	for _, f := range flags {
+
+		// flags from before severities and scopes only had a message
+		// and used to halt everything, they still do until cleared
+		if f.Severity == "" || f.Scope == "" {
+			f.Severity, f.Scope = utils.Halt, "global"
+		}
+
+		if f.Severity != utils.Halt {
+			continue
+		}
+
+		switch f.Scope {
+		case "token":
+			halted_tokens[f.Target] = true
+		case "exchange":
+			halted_exchanges[f.Target] = true
+		default:
+			halted_global = true
+		}
+
+	}
+
+	if halted_global || len(halted_tokens) > 0 || len(halted_exchanges) > 0 {
+		fmt.Println("Flag detected, new transactions halted.")
 	}
 
 }
 
-func throw_flag() {
+// whether the token, or any of the exchanges, is halted
+// exchanges with an open circuit breaker count as halted too
+func is_halted(token string, names ...string) bool {
+
+	if halted_global || halted_tokens[token] {
+		return true
+	}
 
-	mongo.Flag("Buying less than profitable quantity.")
-	panic("Threw flag, killing bot.")
+	for _, name := range names {
+		if halted_exchanges[name] || tripped(name) {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// records a flag and lets discord know about new ones
+func throw_flag(severity, scope, target, message string) {
+
+	// a backtest stops on its own flags
+	// without stalling the live bot
+	if backtesting {
+		backtest_flagged = true
+		return
+	}
+
+	if mongo.Flag(severity, scope, target, message) {
+		discord.Send_alert(strings.Title(severity) + " (" + scope + " " + target + "): " + message)
+	}
+
+	if severity != utils.Halt {
+		return
+	}
+
+	// takes effect right away, not just on the next run
+	switch scope {
+	case "token":
+		halted_tokens[target] = true
+	case "exchange":
+		halted_exchanges[target] = true
+	default:
+		halted_global = true
+	}
 
 }
 
 func daily() {
 
+	jobs_mutex.Lock()
+	defer jobs_mutex.Unlock()
+
 	var message string
 	// save daily balance, for time scale tracking
 	mongo.Save_balances(exchange_balances)
@@ -735,14 +1383,30 @@ func daily() {
 
 	message += "-----------------------trades\n"
 
+	// realized profit of the ones that have completed
+	profits := make(map[string]float64)
+
+	for _, p := range mongo.Get_pnl("trade", from_date, to_date) {
+		profits[p.Key] = p.Profit
+	}
+
 	for _, t := range todays_transactions {
 
 		sell_quantity := fmt.Sprintf("%.2f", t.Sell_quantity)
 		buy_quantity := fmt.Sprintf("%.2f", t.Buy_quantity)
-		message += t.Token + " - sold: " + sell_quantity + ", bought: " + buy_quantity + "\n"
+		message += t.Token + " - sold: " + sell_quantity + ", bought: " + buy_quantity
+
+		if profit, ok := profits[t.ID.Hex()]; ok {
+			message += fmt.Sprintf(", profit: %.5f ETH", profit)
+		}
+
+		message += "\n"
 
 	}
 
+	message += "-----------------------profit\n"
+	message += pnl_summary(1)
+
 	message += "--------------------------end\n"
 
 	// send daily summary to discord
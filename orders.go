@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// when the transaction reached its current status
+// replaced orders restart the clock, as they're recorded in history too
+func placed_at(t utils.Transaction) time.Time {
+
+	for i := len(t.History) - 1; i >= 0; i-- {
+		if t.History[i].To == t.Status {
+			return t.History[i].Timestamp
+		}
+	}
+
+	return t.Timestamp
+
+}
+
+func order_expired(t utils.Transaction) bool {
+
+	return order_max_age > 0 && time.Since(placed_at(t)) > order_max_age
+
+}
+
+// cancels a sell or buy order that has been sitting unfilled for too long
+// then either places it again at the current price, or gives up on it
+func expire_order(t utils.Transaction, side, pair string) {
+
+	row_id := t.ID.Hex()
+	name, tx_id, quantity, price := t.Sell_exchange, t.Sell_tx_id, t.Sell_quantity, t.Sell_price
+
+	if side == "buy" {
+		name, tx_id, quantity, price = t.Buy_exchange, t.Buy_tx_id, t.Buy_quantity, t.Buy_price
+	}
+
+	// transfer trades don't record how much was sold
+	if quantity == 0 {
+		quantity = float64(trade_quantity[t.Token])
+	}
+
+	exchange, ok := get_exchange(name)
+
+	if !ok {
+		return
+	}
+
+	order, cancelled := exchanges.Cancel_expired(exchange, pair, side, tx_id)
+
+	if !cancelled {
+		mongo.Log("Could not cancel " + side + " order " + tx_id + " on " + name + " yet, will retry.")
+		return
+	}
+
+	// whatever filled before the cancel is carried forward
+	// instead of trading the rest of it again
+	if order.Done() {
+
+		if side == "sell" {
+			mongo.Sell_order_completed(row_id, order)
+		} else {
+			mongo.Buy_order_completed(row_id, order)
+		}
+
+		return
+	}
+
+	reason := side + " order timed out, cancelled on " + name
+
+	if order_timeout_policy == "reprice" {
+
+		new_price := current_price(name, pair, side, quantity)
+
+		// without a price, try again on the next run
+		if new_price == 0 {
+			mongo.Log("No price to reprice " + side + " order " + tx_id + " on " + name + ", will retry.")
+			return
+		}
+
+		// buys spend the same amount of quote at the new price
+		if side == "buy" {
+			quantity = quantity * price / new_price
+		}
+
+		// the spread is gone, placing it again would lock in a loss
+		if !reprice_profitable(t, side, quantity) {
+
+			reason = fmt.Sprintf("%s order timed out, no longer profitable at %f, cancelled on %s", side, new_price, name)
+
+		} else {
+
+			new_tx_id, placed := place_order(name, side, pair, quantity, new_price, true)
+
+			// a tripped breaker, a risk limit or an api error
+			// are no reason to drop a trade that's under way
+			if !placed {
+				mongo.Log(fmt.Sprintf("Could not reprice %s order %s on %s at %f, will retry.", side, tx_id, name, new_price))
+				return
+			}
+
+			reason = fmt.Sprintf("%s order timed out, repriced from %f to %f", side, price, new_price)
+			mongo.Order_replaced(row_id, t.Status, side, new_tx_id, quantity, new_price, reason)
+
+			return
+
+		}
+
+	}
+
+	// inventory trades placed their buy along with the sell
+	// which has to go as well, or the trade is left one sided
+	if side == "sell" && t.Strategy == "inventory" && t.Buy_tx_id != "" {
+
+		buyer, ok := get_exchange(t.Buy_exchange)
+
+		if !ok {
+			return
+		}
+
+		bought, cancelled := exchanges.Cancel_expired(buyer, pair, "buy", t.Buy_tx_id)
+
+		if !cancelled {
+			mongo.Log("Could not cancel buy order " + t.Buy_tx_id + " on " + t.Buy_exchange + " of timed out inventory trade yet, will retry.")
+			return
+		}
+
+		// the buy went through without its sell, which
+		// leaves a position someone has to look at
+		if bought.Done() {
+			message := fmt.Sprintf("Inventory buy %s on %s filled %f at %f, its sell on %s timed out.", t.Buy_tx_id, t.Buy_exchange, bought.Quantity, bought.Price, name)
+			throw_flag(utils.Halt, "token", t.Token, message)
+			mongo.Transaction_failed(row_id, t.Status, message)
+			return
+		}
+
+	}
+
+	mongo.Transaction_cancelled(row_id, t.Status, reason)
+
+}
+
+// whether an expired order is still worth placing again
+// sells have to still be the best bid in a profitable comparison
+// buys have to still get back at least what was sold
+func reprice_profitable(t utils.Transaction, side string, quantity float64) bool {
+
+	if side == "buy" {
+
+		needed := t.Sell_quantity
+
+		// inventory trades don't send the token back
+		if t.Strategy != "inventory" {
+			needed += token_withdrawal_fee(t.Buy_exchange, t.Token)
+		}
+
+		return quantity >= needed
+
+	}
+
+	c := comparisons[transaction_pair(t)]
+
+	if c.Bid_exchange != t.Sell_exchange || c.Bid_via != t.Sell_via {
+		return false
+	}
+
+	// inventory trades already have their buy placed
+	if t.Strategy == "inventory" && c.Ask_exchange != t.Buy_exchange {
+		return false
+	}
+
+	return c.Ask_vwap > 0 && c.Executable_difference >= percent_threshold && is_profitable(c)
+
+}
+
+// conversion and triangle legs time out like any other order
+// legs placed before they kept a time fall back to when
+// their transaction or triangle got to where it is
+func leg_expired(leg utils.Leg, fallback time.Time) bool {
+
+	placed := leg.Placed
+
+	if placed.IsZero() {
+		placed = fallback
+	}
+
+	return leg.Tx_id != "" && !leg.Filled && order_max_age > 0 && time.Since(placed) > order_max_age
+
+}
+
+// cancels an expired leg, what filled before the cancel counts
+// as the leg, otherwise "reprice" clears it to be placed again at
+// the current price, false when the leg has to be given up on
+func expire_leg(exchange exchanges.Exchange, name string, leg utils.Leg) (utils.Leg, bool) {
+
+	order, cancelled := exchanges.Cancel_expired(exchange, leg.Pair, leg.Side, leg.Tx_id)
+
+	if !cancelled {
+		mongo.Log("Could not cancel " + leg.Side + " order " + leg.Tx_id + " on " + name + " yet, will retry.")
+		return leg, true
+	}
+
+	if order.Done() {
+		leg.Quantity, leg.Price, leg.Filled = order.Quantity, order.Price, true
+		return leg, true
+	}
+
+	if order_timeout_policy != "reprice" {
+		return leg, false
+	}
+
+	if price := current_price(name, leg.Pair, leg.Side, leg.Quantity); price > 0 {
+		leg.Price = price
+	}
+
+	leg.Tx_id = ""
+
+	return leg, true
+
+}
+
+// every order goes through here, after the risk checks
+// committed orders carry on a trade already under way
+func place_order(name, side, pair string, quantity, price float64, committed bool) (string, bool) {
+
+	exchange, ok := get_exchange(name)
+
+	if !ok || tripped(name) || !allow_order(name, side, pair, quantity, price, committed) {
+		return "", false
+	}
+
+	if side == "buy" {
+		return exchange.Place_buy_order(pair, quantity, price)
+	}
+
+	return exchange.Place_sell_order(pair, quantity, price)
+
+}
+
+// price an order of this size would fill at right now
+// walking the order book, or the last price without one
+func current_price(exchange, pair, side string, quantity float64) float64 {
+
+	book := order_books[exchange][pair]
+	levels := book.Bids
+
+	if side == "buy" {
+		levels = book.Asks
+	}
+
+	if vwap, ok := utils.Vwap(levels, quantity); ok {
+		return vwap
+	}
+
+	return exchange_prices[exchange][pair]
+
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	// utility
+	"./utils"
+)
+
+func TestReprice_profitable(t *testing.T) {
+
+	percent_threshold = 1
+	min_profit_percent = 0.5
+	min_profit["ETH"] = 0.001
+	fees["binance"] = map[string]float64{"LINK": 2}
+
+	transfer := utils.Transaction{
+		Token:         "LINK",
+		Quote:         "ETH",
+		Strategy:      "transfer",
+		Buy_exchange:  "binance",
+		Sell_exchange: "kucoin",
+		Sell_quantity: 100,
+	}
+
+	inventory := transfer
+	inventory.Strategy = "inventory"
+
+	via := transfer
+	via.Sell_via = "BTC"
+
+	spread := utils.Comparison{
+		Quote:                 "ETH",
+		Ask_exchange:          "binance",
+		Bid_exchange:          "kucoin",
+		Ask_vwap:              0.002,
+		Executable_difference: 2,
+		Net_profit:            0.002,
+		Net_percent:           1,
+	}
+
+	cases := []struct {
+		name       string
+		t          utils.Transaction
+		side       string
+		quantity   float64
+		comparison utils.Comparison
+		expected   bool
+	}{
+		{"buy still covers the sell and the withdrawal fee", transfer, "buy", 102, spread, true},
+		{"buy short of the withdrawal fee", transfer, "buy", 101, spread, false},
+		{"inventory buy only needs to cover the sell", inventory, "buy", 100, spread, true},
+		{"sell while the spread holds", transfer, "sell", 100, spread, true},
+		{"sell once the best bid moved to another exchange", transfer, "sell", 100, with(spread, func(c *utils.Comparison) { c.Bid_exchange = "okex" }), false},
+		{"sell through a conversion the spread no longer goes through", via, "sell", 100, spread, false},
+		{"sell through the conversion the spread still goes through", via, "sell", 100, with(spread, func(c *utils.Comparison) { c.Bid_via = "BTC" }), true},
+		{"inventory sell once the best ask moved off its buy exchange", inventory, "sell", 100, with(spread, func(c *utils.Comparison) { c.Ask_exchange = "okex" }), false},
+		{"transfer sell doesn't care where the ask is now", transfer, "sell", 100, with(spread, func(c *utils.Comparison) { c.Ask_exchange = "okex" }), true},
+		{"sell with no ask depth left", transfer, "sell", 100, with(spread, func(c *utils.Comparison) { c.Ask_vwap = 0 }), false},
+		{"sell below the percent threshold", transfer, "sell", 100, with(spread, func(c *utils.Comparison) { c.Executable_difference = 0.5 }), false},
+		{"sell below the minimum profit", transfer, "sell", 100, with(spread, func(c *utils.Comparison) { c.Net_profit = 0.0005 }), false},
+		{"sell below the minimum profit percent", transfer, "sell", 100, with(spread, func(c *utils.Comparison) { c.Net_percent = 0.2 }), false},
+	}
+
+	for _, c := range cases {
+
+		comparisons["LINK-ETH"] = c.comparison
+
+		if profitable := reprice_profitable(c.t, c.side, c.quantity); profitable != c.expected {
+			t.Errorf("%s: got %v, expected %v", c.name, profitable, c.expected)
+		}
+
+	}
+
+	// nothing compared for the pair this run
+	delete(comparisons, "LINK-ETH")
+
+	if reprice_profitable(transfer, "sell", 100) {
+		t.Error("repriced a sell without a comparison for its pair")
+	}
+
+}
+
+// copy of a comparison with one thing changed
+func with(c utils.Comparison, change func(*utils.Comparison)) utils.Comparison {
+
+	change(&c)
+
+	return c
+
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// writes every transaction that has reset its balances to the ledger
+func record_ledger() {
+
+	for _, t := range mongo.Get_unledgered_transactions() {
+
+		entries, ok := ledger_entries(t)
+
+		if !ok {
+			continue
+		}
+
+		mongo.Ledger_recorded(t.ID.Hex(), entries)
+
+	}
+
+}
+
+// splits a completed transaction into what it earned and spent
+// everything is valued in the quote, then converted to ETH
+// tokens are valued at the buy price, so that buying back more
+// or fewer than were sold shows up as the token shortfall
+func ledger_entries(t utils.Transaction) ([]utils.Ledger_entry, bool) {
+
+	pair := transaction_pair(t)
+	quote := utils.Pair_quote(pair)
+
+	rate := 1.0
+
+	if quote != "ETH" {
+		rate = conversion_rate(t.Sell_exchange, quote, "ETH")
+	}
+
+	// transactions from before fills were recorded
+	// have nothing to go by, they're marked without entries
+	if t.Buy_quantity == 0 || t.Sell_quantity == 0 {
+		return nil, true
+	}
+
+	// without a rate the transaction waits for the next run
+	// rather than being ledgered as if its quote were ETH
+	if rate == 0 {
+		mongo.Log(fmt.Sprintf("No %s to ETH rate on %s to ledger transaction %s, will retry.", quote, t.Sell_exchange, t.ID.Hex()))
+		return nil, false
+	}
+
+	quote_fee := 0.0
+	token_fee := 0.0
+
+	if t.Strategy != "inventory" {
+		quote_fee = fees[t.Sell_exchange][quote]
+		token_fee = token_withdrawal_fee(t.Buy_exchange, t.Token)
+	}
+
+	// synthetic legs have their fees in the converted amounts already
+	proceeds := t.Sell_cost
+	sell_fee := 0.0
+
+	if t.Sell_via == "" {
+		proceeds = t.Sell_quantity * t.Sell_price
+		sell_fee = trading_fee(t.Sell_exchange, proceeds, proceeds-t.Sell_cost)
+	}
+
+	cost := t.Sell_cost - quote_fee
+	buy_fee := 0.0
+
+	if t.Buy_via == "" {
+		cost = t.Buy_quantity * t.Buy_price
+		buy_fee = trading_fee(t.Buy_exchange, cost, t.Buy_cost-cost)
+	}
+
+	buy_price := cost / t.Buy_quantity
+
+	amounts := []struct {
+		kind   string
+		amount float64
+	}{
+		{"sell_proceeds", proceeds},
+		{"trading_fee", -sell_fee - buy_fee},
+		{"withdrawal_fee", -quote_fee - token_fee*buy_price},
+		{"buy_cost", -cost},
+		{"token_shortfall", (t.Buy_quantity - t.Sell_quantity) * buy_price},
+	}
+
+	var entries []utils.Ledger_entry
+
+	for _, a := range amounts {
+		entries = append(entries, utils.Ledger_entry{
+			Trade:         t.ID.Hex(),
+			Token:         t.Token,
+			Quote:         quote,
+			Sell_exchange: t.Sell_exchange,
+			Buy_exchange:  t.Buy_exchange,
+			Kind:          a.kind,
+			Amount:        a.amount * rate,
+			Timestamp:     placed_at(t),
+		})
+	}
+
+	return entries, true
+
+}
+
+// fee an exchange reported for an order, or when it doesn't
+// report any, what its trading fee works out to
+func trading_fee(exchange string, value, reported float64) float64 {
+
+	if reported > 0 {
+		return reported
+	}
+
+	return value * trade_fees[exchange] / 100
+
+}
+
+// realized profit over the last given days, formatted for messages
+// per token and per pair of exchanges
+func pnl_summary(days int) string {
+
+	var message string
+
+	to_date := time.Now()
+	from_date := to_date.AddDate(0, 0, -days)
+	total := 0.0
+
+	for _, p := range mongo.Get_pnl("token", from_date, to_date) {
+		message += fmt.Sprintf("%s - %d trades, %.5f ETH\n", p.Key, p.Trades, p.Profit)
+		total += p.Profit
+	}
+
+	for _, p := range mongo.Get_pnl("exchanges", from_date, to_date) {
+		message += fmt.Sprintf("%s - %d trades, %.5f ETH\n", p.Key, p.Trades, p.Profit)
+	}
+
+	message += fmt.Sprintf("total - %.5f ETH\n", total)
+
+	return message
+
+}
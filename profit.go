@@ -0,0 +1,116 @@
+package main
+
+import (
+	// utility
+	"./utils"
+)
+
+// 4 tokens was the original, arbitrary allowance for
+// token withdrawal fees, still used when none is configured
+const default_token_withdrawal_fee = 4
+
+type Profit_estimate struct {
+	Quantity      float64
+	Proceeds      float64
+	Quote_arrived float64
+	Tokens_bought float64
+	Token_fee     float64
+	Net_profit    float64
+	Net_percent   float64
+}
+
+// walks one full arbitrage cycle on paper
+// sell quantity into the bids, pay the trading fee, withdraw the quote,
+// buy back from the asks, pay the trading fee again and send
+// enough tokens back to cover the withdrawal fee
+// whatever tokens are left over is our profit, valued in the quote
+func estimate_profit(sell_exchange, buy_exchange, token, quote string, quantity, sell_price, buy_price float64) Profit_estimate {
+
+	e := Profit_estimate{Quantity: quantity}
+
+	if quantity <= 0 || sell_price <= 0 || buy_price <= 0 {
+		return e
+	}
+
+	e.Proceeds = quantity * sell_price * (1 - trade_fees[sell_exchange]/100)
+	e.Quote_arrived = e.Proceeds - fees[sell_exchange][quote]
+	e.Tokens_bought = e.Quote_arrived / buy_price * (1 - trade_fees[buy_exchange]/100)
+	e.Token_fee = token_withdrawal_fee(buy_exchange, token)
+
+	surplus := e.Tokens_bought - quantity - e.Token_fee
+	e.Net_profit = surplus * buy_price
+	e.Net_percent = e.Net_profit / (quantity * sell_price) * 100
+
+	return e
+
+}
+
+// selling and buying at once from held balances
+// only trading fees apply, withdrawals happen later when rebalancing
+func estimate_inventory_profit(sell_exchange, buy_exchange string, quantity, sell_price, buy_price float64) Profit_estimate {
+
+	e := Profit_estimate{Quantity: quantity}
+
+	if quantity <= 0 || sell_price <= 0 || buy_price <= 0 {
+		return e
+	}
+
+	e.Proceeds = quantity * sell_price * (1 - trade_fees[sell_exchange]/100)
+	cost := quantity * buy_price * (1 + trade_fees[buy_exchange]/100)
+
+	e.Net_profit = e.Proceeds - cost
+	e.Net_percent = e.Net_profit / (quantity * sell_price) * 100
+
+	return e
+
+}
+
+// fills in net profit of trading the comparison's executable prices
+func estimate_net_profit(c utils.Comparison, token string, quantity float64) utils.Comparison {
+
+	if c.Ask_vwap == 0 || c.Bid_vwap == 0 {
+		return c
+	}
+
+	sell_price := c.Bid_vwap
+	buy_price := c.Ask_vwap
+
+	// synthetic markets pay one more trading fee
+	// converting to or from the quote they go through
+	if c.Bid_via != "" {
+		sell_price *= 1 - trade_fees[c.Bid_exchange]/100
+	}
+
+	if c.Ask_via != "" {
+		buy_price /= 1 - trade_fees[c.Ask_exchange]/100
+	}
+
+	e := estimate_profit(c.Bid_exchange, c.Ask_exchange, token, c.Quote, quantity, sell_price, buy_price)
+
+	if strategy == "inventory" {
+		e = estimate_inventory_profit(c.Bid_exchange, c.Ask_exchange, quantity, c.Bid_vwap, c.Ask_vwap)
+	}
+
+	c.Net_profit = utils.ToFixed(e.Net_profit, 8)
+	c.Net_percent = utils.ToFixed(e.Net_percent, 2)
+
+	return c
+
+}
+
+func is_profitable(c utils.Comparison) bool {
+
+	return c.Net_profit > 0 && c.Net_profit >= min_profit[c.Quote] && c.Net_percent >= min_profit_percent
+
+}
+
+// token withdrawal fee configured as <EXCHANGE>_<TOKEN>_FEE
+func token_withdrawal_fee(exchange, token string) float64 {
+
+	if fee, ok := fees[exchange][token]; ok {
+		return fee
+	}
+
+	return default_token_withdrawal_fee
+
+}
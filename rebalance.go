@@ -0,0 +1,247 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// inventory trades leave quotes piling up on one exchange and tokens
+// on another, rebalancing moves them back toward target allocations
+// targets are percent of an asset's total, <EXCHANGE>_<ASSET>_TARGET=50
+// exchanges without a target share whatever is left equally
+func rebalance() {
+
+	jobs_mutex.Lock()
+	defer jobs_mutex.Unlock()
+
+	pending := make(map[string]bool)
+
+	for _, r := range mongo.Get_pending_rebalances() {
+		pending[r.Asset] = true
+	}
+
+	for _, asset := range rebalance_assets() {
+
+		// one transfer per asset at a time
+		// balances are off until it lands
+		if pending[asset] {
+			continue
+		}
+
+		rebalance_asset(asset)
+
+	}
+
+}
+
+func rebalance_asset(asset string) {
+
+	holders := rebalance_exchanges(asset)
+
+	if len(holders) < 2 {
+		return
+	}
+
+	total := 0.0
+
+	for _, exchange := range holders {
+		total += exchange_balances[exchange][asset]
+	}
+
+	if total <= 0 {
+		return
+	}
+
+	targets := rebalance_targets(asset, holders)
+	surplus := make(map[string]float64)
+	deficit := ""
+	deficit_amount := 0.0
+
+	for _, exchange := range holders {
+
+		target := total * targets[exchange] / 100
+		difference := exchange_balances[exchange][asset] - target
+		drift := difference / total * 100
+
+		if drift > rebalance_drift {
+			surplus[exchange] = difference
+		}
+
+		if drift < -rebalance_drift && -difference > deficit_amount {
+			deficit = exchange
+			deficit_amount = -difference
+		}
+
+	}
+
+	if deficit == "" || len(surplus) == 0 {
+		return
+	}
+
+	// cheapest route is the surplus exchange
+	// charging the lowest fee to withdraw this asset
+	from := ""
+
+	for exchange := range surplus {
+		if from == "" || withdrawal_fee(exchange, asset) < withdrawal_fee(from, asset) {
+			from = exchange
+		}
+	}
+
+	amount := utils.ToFixed(minimum(surplus[from], deficit_amount), 4)
+	fee := withdrawal_fee(from, asset)
+
+	if amount <= fee {
+		return
+	}
+
+	// no new transfers in or out of halted exchanges
+	if is_halted("", from, deficit) {
+		return
+	}
+
+	destination := deposit_address(deficit, asset)
+	withdrawal_id, started := withdraw(from, asset, destination, amount)
+
+	if started {
+		mongo.Rebalance_started(utils.Rebalance{
+			Asset:         asset,
+			From_exchange: from,
+			To_exchange:   deficit,
+			Amount:        amount,
+			Fee:           fee,
+			Withdrawal_id: withdrawal_id,
+		})
+	}
+
+}
+
+// checks whether rebalancing transfers have landed
+// by looking for the deposit on the receiving exchange
+func track_rebalances() {
+
+	for _, r := range mongo.Get_pending_rebalances() {
+
+		exchange, ok := exchanges.Get(r.To_exchange)
+
+		if !ok {
+			continue
+		}
+
+		txid := r.Txid
+
+		if txid == "" {
+
+			txid = withdrawal_txid(r.From_exchange, r.Asset, r.Withdrawal_id)
+
+			if txid != "" {
+				mongo.Rebalance_txid_resolved(r.ID.Hex(), txid)
+			}
+
+		}
+
+		deposit_id, landed := exchange.Check_if_transferred(r.Asset, txid, r.Amount-r.Fee, r.Timestamp, mongo.Get_matched_deposits(r.To_exchange))
+
+		if landed {
+			mongo.Rebalance_landed(r.ID.Hex(), deposit_id)
+		}
+
+	}
+
+}
+
+// every quote and every token we trade
+func rebalance_assets() []string {
+
+	var assets []string
+
+	for quote := range quotes {
+		assets = append(assets, quote)
+	}
+
+	for token := range tokens {
+		if trade_quantity[token] > 0 {
+			assets = append(assets, token)
+		}
+	}
+
+	return assets
+
+}
+
+// enabled exchanges we can send the asset to
+func rebalance_exchanges(asset string) []string {
+
+	var holders []string
+
+	for _, name := range exchanges.Names() {
+		if address_book[name][asset] != "" {
+			holders = append(holders, name)
+		}
+	}
+
+	return holders
+
+}
+
+func rebalance_targets(asset string, holders []string) map[string]float64 {
+
+	targets := make(map[string]float64)
+	assigned := 0.0
+	unassigned := 0
+
+	for _, exchange := range holders {
+
+		value := props[strings.ToUpper(exchange)+"_"+asset+"_TARGET"]
+
+		if value == "" {
+			unassigned++
+			continue
+		}
+
+		target, err := strconv.ParseFloat(value, 64)
+		utils.Check(err)
+
+		targets[exchange] = target
+		assigned += target
+
+	}
+
+	for _, exchange := range holders {
+		if _, ok := targets[exchange]; !ok {
+			targets[exchange] = (100 - assigned) / float64(unassigned)
+		}
+	}
+
+	return targets
+
+}
+
+func withdrawal_fee(exchange, asset string) float64 {
+
+	if quotes[asset] {
+		return fees[exchange][asset]
+	}
+
+	return token_withdrawal_fee(exchange, asset)
+
+}
+
+func minimum(a, b float64) float64 {
+
+	if a < b {
+		return a
+	}
+
+	return b
+
+}
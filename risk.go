@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// pre-trade risk checks, every order and withdrawal has to pass them
+// limits are set with RISK_<LIMIT> for everything, and overridden
+// with <TOKEN>_<LIMIT> or <EXCHANGE>_<LIMIT> for just one of them
+// an order in scope of both takes the stricter of the two
+// leaving a limit empty turns it off
+// ex: RISK_MAX_NOTIONAL=2, NULS_MAX_NOTIONAL=0.5, BITZ_MAX_SHARE=25
+func risk_limit(name string, scopes ...string) float64 {
+
+	limit := 0.0
+
+	for _, scope := range scopes {
+
+		value, err := strconv.ParseFloat(props[strings.ToUpper(scope)+"_"+name], 64)
+
+		if err == nil && value > 0 && (limit == 0 || value < limit) {
+			limit = value
+		}
+
+	}
+
+	if limit > 0 {
+		return limit
+	}
+
+	value, err := strconv.ParseFloat(props["RISK_"+name], 64)
+
+	if err != nil {
+		return 0
+	}
+
+	return value
+
+}
+
+// starting a new trade in a token, on top of checking its orders
+// limits how many are open at once and stops after a bad day
+func allow_trade(token string) bool {
+
+	if limit := risk_limit("MAX_OPEN", token); limit > 0 {
+
+		open := mongo.Count_open_transactions(token)
+
+		if float64(open) >= limit {
+			return reject("trade", "MAX_OPEN", "", token, 0, fmt.Sprintf("%d open transactions, limit is %.0f", open, limit))
+		}
+
+	}
+
+	if limit := risk_limit("MAX_DAILY_LOSS"); limit > 0 {
+
+		loss := -daily_profit()
+
+		if loss >= limit {
+			return reject("trade", "MAX_DAILY_LOSS", "", token, 0, fmt.Sprintf("lost %f ETH in the last day, limit is %f", loss, limit))
+		}
+
+	}
+
+	return true
+
+}
+
+// every order, limits its value in ETH per token
+// and how much of the exchange's balance it may use up
+// committed orders carry on a trade already under way, spending
+// what was set aside for it, ie the quote a transfer brought in
+// so they're left out of the share of the balance
+func allow_order(exchange, side, pair string, quantity, price float64, committed bool) bool {
+
+	token := utils.Pair_token(pair)
+	quote := utils.Pair_quote(pair)
+	cost := quantity * price
+
+	if limit := risk_limit("MAX_NOTIONAL", token, exchange); limit > 0 {
+
+		notional, ok := eth_value(exchange, quote, cost)
+
+		if !ok {
+			return reject("order", "MAX_NOTIONAL", exchange, pair, cost, "no ETH price for "+quote+" to value the order")
+		}
+
+		if notional > limit {
+			return reject("order", "MAX_NOTIONAL", exchange, pair, cost, fmt.Sprintf("worth %f ETH, limit is %f", notional, limit))
+		}
+
+	}
+
+	if limit := risk_limit("MAX_SHARE", token, exchange); limit > 0 && !committed {
+
+		asset, amount := token, quantity
+
+		if side == "buy" {
+			asset, amount = quote, cost
+		}
+
+		balance := exchange_balances[exchange][asset]
+
+		if balance <= 0 || amount/balance*100 > limit {
+			return reject("order", "MAX_SHARE", exchange, pair, cost, fmt.Sprintf("uses %f of %f %s, limit is %.2f%%", amount, balance, asset, limit))
+		}
+
+	}
+
+	return true
+
+}
+
+// every withdrawal, limits how much is on its way between exchanges
+func allow_withdrawal(exchange, asset string, amount float64) bool {
+
+	limit := risk_limit("MAX_IN_TRANSIT")
+
+	if limit <= 0 {
+		return true
+	}
+
+	value, ok := eth_value(exchange, asset, amount)
+
+	if !ok {
+		return reject("withdrawal", "MAX_IN_TRANSIT", exchange, asset, amount, "no ETH price for "+asset+" to value the withdrawal")
+	}
+
+	transit := in_transit()
+
+	if transit+value > limit {
+		return reject("withdrawal", "MAX_IN_TRANSIT", exchange, asset, amount, fmt.Sprintf("%f ETH already in transit, limit is %f", transit, limit))
+	}
+
+	return true
+
+}
+
+// ETH value of quotes moving between exchanges and of rebalancing transfers
+func in_transit() float64 {
+
+	total := 0.0
+
+	for _, t := range mongo.Get_incomplete_transactions() {
+
+		if t.Status != utils.TransferStarted {
+			continue
+		}
+
+		quote := utils.Pair_quote(transaction_pair(t))
+
+		if value, ok := eth_value(t.Sell_exchange, quote, t.Sell_cost); ok {
+			total += value
+		}
+
+	}
+
+	for _, r := range mongo.Get_pending_rebalances() {
+
+		if value, ok := eth_value(r.From_exchange, r.Asset, r.Amount); ok {
+			total += value
+		}
+
+	}
+
+	return total
+
+}
+
+// realized profit over the last 24 hours, negative on a loss
+func daily_profit() float64 {
+
+	profit := 0.0
+	to_date := time.Now()
+	from_date := to_date.Add(-24 * time.Hour)
+
+	for _, p := range mongo.Get_pnl("quote", from_date, to_date) {
+		profit += p.Profit
+	}
+
+	return profit
+
+}
+
+// value of an amount of any asset in ETH, priced on the given
+// exchange, or on any other that has a market for it
+func eth_value(exchange, asset string, amount float64) (float64, bool) {
+
+	if asset == "ETH" {
+		return amount, true
+	}
+
+	if rate := conversion_rate(exchange, asset, "ETH"); rate > 0 {
+		return amount * rate, true
+	}
+
+	for name := range exchange_prices {
+		if rate := conversion_rate(name, asset, "ETH"); rate > 0 {
+			return amount * rate, true
+		}
+	}
+
+	return 0, false
+
+}
+
+// records why something was refused, always returns false
+// so checks can hand it straight back
+func reject(action, limit, exchange, market string, amount float64, reason string) bool {
+
+	mongo.Risk_rejected(utils.Rejection{
+		Action:   action,
+		Limit:    limit,
+		Exchange: exchange,
+		Market:   market,
+		Amount:   amount,
+		Reason:   reason,
+	})
+
+	return false
+
+}
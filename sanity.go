@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	// utility
+	"./utils"
+)
+
+// tickers of exchanges that report them
+// ex: ["binance"]["NULS-ETH"] = {Price: 0.04, Volume: 120.5, ...}
+var exchange_tickers = make(map[string]map[string]utils.Ticker)
+
+// prices left out of the last run's comparisons, and why
+// ex: ["NULS-ETH"] = [{Exchange: "bitz", Price: 0.0004, Reason: "..."}]
+var rejected_prices = make(map[string][]utils.Rejected_price)
+
+// drops prices that can't be trusted before they're compared
+// PRICE_MAX_AGE seconds since the market last traded
+// PRICE_MIN_VOLUME 24h volume in ETH, other quotes are converted
+// PRICE_MAX_DEVIATION times above or below the median of every
+// exchange's price, which takes 3 or more to tell which is off
+// leaving a setting empty turns its check off, and age and volume
+// are only checked on exchanges that report them
+func validate_prices(exchange_prices map[string]map[string]float64) map[string]map[string]float64 {
+
+	rejected_prices = make(map[string][]utils.Rejected_price)
+
+	valid := make(map[string]map[string]float64)
+	markets := make(map[string]map[string]float64)
+
+	for name, prices := range exchange_prices {
+
+		valid[name] = make(map[string]float64)
+
+		for pair, price := range prices {
+
+			if reason := stale_or_thin(name, pair); reason != "" {
+				reject_price(name, pair, price, reason)
+				continue
+			}
+
+			if markets[pair] == nil {
+				markets[pair] = make(map[string]float64)
+			}
+
+			markets[pair][name] = price
+
+		}
+
+	}
+
+	factor := prop_float("PRICE_MAX_DEVIATION", 0)
+
+	for pair, prices := range markets {
+
+		var values []float64
+
+		for _, price := range prices {
+			values = append(values, price)
+		}
+
+		median := utils.Median(values)
+
+		for name, price := range prices {
+
+			if factor > 1 && len(values) >= 3 && (price > median*factor || price < median/factor) {
+				reject_price(name, pair, price, fmt.Sprintf("%.2fx off the median of %f", price/median, median))
+				continue
+			}
+
+			valid[name][pair] = price
+
+		}
+
+	}
+
+	return valid
+
+}
+
+// why a market's ticker can't be trusted, empty when it can
+func stale_or_thin(exchange, pair string) string {
+
+	ticker, ok := exchange_tickers[exchange][pair]
+
+	if !ok {
+		return ""
+	}
+
+	if max_age := prop_float("PRICE_MAX_AGE", 0); max_age > 0 && !ticker.Timestamp.IsZero() {
+
+		age := time.Since(ticker.Timestamp).Seconds()
+
+		if age > max_age {
+			return fmt.Sprintf("last traded %.0f seconds ago, limit is %.0f", age, max_age)
+		}
+
+	}
+
+	if min_volume := prop_float("PRICE_MIN_VOLUME", 0); min_volume > 0 {
+
+		volume, ok := eth_value(exchange, utils.Pair_quote(pair), ticker.Volume)
+
+		if ok && volume < min_volume {
+			return fmt.Sprintf("24h volume of %f ETH, floor is %f", volume, min_volume)
+		}
+
+	}
+
+	return ""
+
+}
+
+func reject_price(exchange, pair string, price float64, reason string) {
+
+	rejected_prices[pair] = append(rejected_prices[pair], utils.Rejected_price{
+		Exchange: exchange,
+		Price:    price,
+		Reason:   reason,
+	})
+
+}
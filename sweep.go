@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// moves realized ETH profit off the exchanges to TREZOR_ETH
+// each exchange keeps a working balance for trading with
+// <EXCHANGE>_ETH_WORKING=amount, or SWEEP_WORKING_BALANCE for all
+// and nothing more than the profit not yet swept ever leaves
+func sweep() {
+
+	jobs_mutex.Lock()
+	defer jobs_mutex.Unlock()
+
+	destination := deposit_address("trezor", "ETH")
+
+	if destination == "" {
+		mongo.Log("TREZOR_ETH is not in the address book, skipping sweep.")
+		return
+	}
+
+	unswept := realized_profit()
+
+	for _, s := range mongo.Get_sweeps() {
+		unswept -= s.Amount
+	}
+
+	for _, name := range exchanges.Names() {
+
+		if unswept <= 0 {
+			return
+		}
+
+		if is_halted("", name) {
+			continue
+		}
+
+		surplus := exchange_balances[name]["ETH"] - working_balance(name)
+		amount := utils.ToFixed(minimum(surplus, unswept), 4)
+		fee := fees[name]["ETH"]
+
+		if amount <= fee {
+			continue
+		}
+
+		withdrawal_id, started := withdraw(name, "ETH", destination, amount)
+
+		if started {
+
+			mongo.Sweep_started(utils.Sweep{
+				Exchange:      name,
+				Asset:         "ETH",
+				Amount:        amount,
+				Fee:           fee,
+				Destination:   destination,
+				Withdrawal_id: withdrawal_id,
+			})
+
+			unswept -= amount
+			exchange_balances[name]["ETH"] -= amount
+
+		}
+
+	}
+
+}
+
+// ETH made by completed ETH market trades, as written to the ledger
+func realized_profit() float64 {
+
+	for _, p := range mongo.Get_pnl("quote", time.Time{}, time.Now()) {
+		if p.Key == "ETH" {
+			return p.Profit
+		}
+	}
+
+	return 0
+
+}
+
+func working_balance(exchange string) float64 {
+
+	value := props[strings.ToUpper(exchange)+"_ETH_WORKING"]
+
+	if value == "" {
+		value = props["SWEEP_WORKING_BALANCE"]
+	}
+
+	amount, err := strconv.ParseFloat(value, 64)
+
+	// without a working balance nothing is swept
+	if err != nil {
+		return exchange_balances[exchange]["ETH"]
+	}
+
+	return amount
+
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// an exchange that doesn't list TOKEN-ETH may still list TOKEN-BTC
+// along with a market between BTC and ETH, multiplying the two
+// gives a synthetic TOKEN-ETH price, ex: TOKEN-BTC x BTC-ETH
+// such markets are compared like any other, the extra
+// conversion is carried out as a leg of the transaction
+
+// value of one unit of from, expressed in to
+// read off whichever market between them the exchange lists
+func conversion_rate(exchange, from, to string) float64 {
+
+	prices := exchange_prices[exchange]
+
+	if price := prices[utils.Pair(from, to)]; price > 0 {
+		return price
+	}
+
+	if price := prices[utils.Pair(to, from)]; price > 0 {
+		return 1 / price
+	}
+
+	return 0
+
+}
+
+// adds synthetic prices for exchanges missing the market
+// and returns which quote each of them goes through
+func synthetic_prices(token, quote string, prices map[string]float64) (map[string]float64, map[string]string) {
+
+	vias := make(map[string]string)
+
+	for exchange, markets := range exchange_prices {
+
+		if prices[exchange] > 0 {
+			continue
+		}
+
+		for via := range quotes {
+
+			price := markets[utils.Pair(token, via)]
+			rate := conversion_rate(exchange, via, quote)
+
+			if via != quote && price > 0 && rate > 0 {
+				prices[exchange] = price * rate
+				vias[exchange] = via
+				break
+			}
+
+		}
+
+	}
+
+	return prices, vias
+
+}
+
+// same as synthetic_prices, but for order books
+// levels are repriced in the quote, quantities stay in tokens
+func synthetic_order_books(token, quote string, books map[string]utils.Order_book, vias map[string]string) map[string]utils.Order_book {
+
+	for exchange, via := range vias {
+
+		book := order_books[exchange][utils.Pair(token, via)]
+		rate := conversion_rate(exchange, via, quote)
+
+		if len(book.Bids) == 0 || len(book.Asks) == 0 || rate == 0 {
+			continue
+		}
+
+		books[exchange] = utils.Order_book{
+			Bids: reprice_levels(book.Bids, rate),
+			Asks: reprice_levels(book.Asks, rate),
+		}
+
+	}
+
+	return books
+
+}
+
+func reprice_levels(levels []utils.Order_level, rate float64) []utils.Order_level {
+
+	var repriced []utils.Order_level
+
+	for _, level := range levels {
+		repriced = append(repriced, utils.Order_level{Price: level.Price * rate, Quantity: level.Quantity})
+	}
+
+	return repriced
+
+}
+
+// order turning amount of from into to on the exchange
+// buying to where it is the base, selling from otherwise
+func conversion_leg(exchange, from, to string, amount float64) (utils.Leg, bool) {
+
+	prices := exchange_prices[exchange]
+
+	if price := prices[utils.Pair(to, from)]; price > 0 {
+		return utils.Leg{Pair: utils.Pair(to, from), Side: "buy", Quantity: utils.ToFixed(amount/price, 8), Price: price}, true
+	}
+
+	if price := prices[utils.Pair(from, to)]; price > 0 {
+		return utils.Leg{Pair: utils.Pair(from, to), Side: "sell", Quantity: amount, Price: price}, true
+	}
+
+	return utils.Leg{}, false
+
+}
+
+// what a filled conversion leg left us with, after the trading fee
+func converted_amount(exchange string, leg utils.Leg) float64 {
+
+	keep := 1 - trade_fees[exchange]/100
+
+	if leg.Side == "buy" {
+		return leg.Quantity * keep
+	}
+
+	return leg.Quantity * leg.Price * keep
+
+}
+
+// moves a transaction's conversion leg along
+// placing it on the first call and returning it once filled
+// legs that time out are placed again or fail the transaction
+func convert(t utils.Transaction, side, name, from, to string, leg utils.Leg, amount float64) (utils.Leg, bool) {
+
+	row_id := t.ID.Hex()
+	exchange, ok := get_exchange(name)
+
+	if !ok {
+		return leg, false
+	}
+
+	if leg.Tx_id == "" {
+
+		leg, ok = conversion_leg(name, from, to, amount)
+
+		if !ok {
+			return leg, false
+		}
+
+		tx_id, placed := place_leg(name, leg, true)
+
+		if placed {
+			leg.Tx_id = tx_id
+			leg.Placed = time.Now()
+			mongo.Conversion_updated(row_id, side, leg)
+		}
+
+		return leg, false
+
+	}
+
+	if leg_expired(leg, placed_at(t)) {
+
+		leg, ok = expire_leg(exchange, name, leg)
+
+		if !ok {
+			mongo.Transaction_failed(row_id, t.Status, "conversion of "+from+" to "+to+" timed out, cancelled on "+name)
+			return leg, false
+		}
+
+		mongo.Conversion_updated(row_id, side, leg)
+
+		return leg, leg.Filled
+
+	}
+
+	if !leg_filled(exchange, leg) {
+		return leg, false
+	}
+
+	leg.Filled = true
+	mongo.Conversion_updated(row_id, side, leg)
+
+	return leg, true
+
+}
+
+func place_leg(name string, leg utils.Leg, committed bool) (string, bool) {
+
+	return place_order(name, leg.Side, leg.Pair, leg.Quantity, leg.Price, committed)
+
+}
+
+func leg_filled(exchange exchanges.Exchange, leg utils.Leg) bool {
+
+	return exchange.Get_order(leg.Pair, leg.Side, leg.Tx_id).Done()
+
+}
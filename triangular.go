@@ -0,0 +1,247 @@
+package main
+
+import (
+	"time"
+
+	// common exchange interface and registry
+	"./exchanges"
+
+	// database package
+	"./db/mongo"
+
+	// utility
+	"./utils"
+)
+
+// reports found cycles, executes them if enabled
+// and moves along the ones already placed
+func resolve_triangles() {
+
+	triangles := find_triangles()
+	mongo.Save_triangles(triangles)
+
+	if triangular_execute {
+
+		open := open_triangles()
+
+		for _, t := range triangles {
+			if !open[t.Exchange+t.Token] {
+				execute_triangle(t)
+				open[t.Exchange+t.Token] = true
+			}
+		}
+
+	}
+
+	track_triangles()
+
+}
+
+// triangular arbitrage stays on a single exchange
+// a token priced in two quotes, plus the market between
+// those quotes, forms a cycle, ex: ETH -> NULS -> BTC -> ETH
+// going around it with more than we started, after three
+// trading fees, is an opportunity
+func find_triangles() []utils.Triangle {
+
+	var found []utils.Triangle
+
+	for _, name := range exchanges.Names() {
+
+		if tripped(name) {
+			continue
+		}
+
+		for token := range tokens {
+
+			if trade_quantity[token] == 0 {
+				continue
+			}
+
+			// every ordered pair of quotes, the reverse cycle
+			// is the same one started from the other quote
+			for start := range quotes {
+				for via := range quotes {
+
+					if start == via {
+						continue
+					}
+
+					triangle, ok := build_triangle(name, token, start, via)
+
+					if ok && triangle.Profit_percent >= triangular_threshold {
+						found = append(found, triangle)
+					}
+
+				}
+			}
+
+		}
+
+	}
+
+	return found
+
+}
+
+// buys the token with start, sells it for via
+// and converts via back to start, on whichever
+// of the two markets between them the exchange lists
+func build_triangle(exchange, token, start, via string) (utils.Triangle, bool) {
+
+	prices := exchange_prices[exchange]
+	quantity := float64(trade_quantity[token])
+
+	t := utils.Triangle{Exchange: exchange, Start: start, Token: token, Via: via}
+
+	buy_price := prices[utils.Pair(token, start)]
+	sell_price := prices[utils.Pair(token, via)]
+
+	if buy_price == 0 || sell_price == 0 {
+		return t, false
+	}
+
+	t.Legs = []utils.Leg{
+		{Pair: utils.Pair(token, start), Side: "buy", Quantity: quantity, Price: buy_price},
+		{Pair: utils.Pair(token, via), Side: "sell", Quantity: quantity, Price: sell_price},
+	}
+
+	// ex: buying ETH on ETH-BTC with the BTC we got
+	back, ok := conversion_leg(exchange, via, start, quantity*sell_price)
+
+	if !ok {
+		return t, false
+	}
+
+	t.Legs = append(t.Legs, back)
+
+	keep := 1 - trade_fees[exchange]/100
+	rate := conversion_rate(exchange, via, start)
+	multiplier := (1 / buy_price) * keep * sell_price * keep * rate * keep
+
+	t.Profit_percent = utils.ToFixed((multiplier-1)*100, 2)
+
+	return t, true
+
+}
+
+// places all three legs at once from balances already
+// held on the exchange, same idea as the inventory strategy
+func execute_triangle(t utils.Triangle) {
+
+	token_leg, via_leg := t.Legs[0], t.Legs[1]
+	balances := exchange_balances[t.Exchange]
+
+	if balances[t.Start] < token_leg.Quantity*token_leg.Price || balances[t.Token] < via_leg.Quantity || balances[t.Via] < via_leg.Quantity*via_leg.Price {
+		return
+	}
+
+	if is_halted(t.Token, t.Exchange) || !allow_trade(t.Token) {
+		return
+	}
+
+	placed := false
+
+	// a failed leg keeps an empty tx id
+	// and is placed again by track_triangles
+	for i, leg := range t.Legs {
+
+		tx_id, ok := place_leg(t.Exchange, leg, false)
+		t.Legs[i].Tx_id = tx_id
+		t.Legs[i].Placed = time.Now()
+		placed = placed || ok
+
+	}
+
+	if !placed {
+		return
+	}
+
+	mongo.Place_triangle(t)
+
+	// balances are only refreshed once per run
+	// keep them honest for the rest of this one
+	balances[t.Start] -= token_leg.Quantity * token_leg.Price
+	balances[t.Token] -= via_leg.Quantity
+	balances[t.Via] -= via_leg.Quantity * via_leg.Price
+
+}
+
+// checks on legs of placed triangles, retrying any that failed
+// legs that time out are placed again at the current price
+// or given up on, depending on ORDER_TIMEOUT_POLICY
+func track_triangles() {
+
+	for _, t := range mongo.Get_open_triangles() {
+
+		if !halt_resume && is_halted(t.Token, t.Exchange) {
+			continue
+		}
+
+		exchange, ok := get_exchange(t.Exchange)
+		if !ok {
+			continue
+		}
+
+		changed := false
+		completed := true
+
+		for i, leg := range t.Legs {
+
+			if leg.Filled || leg.Cancelled {
+				continue
+			}
+
+			if leg_expired(leg, t.Timestamp) {
+
+				leg, ok = expire_leg(exchange, t.Exchange, leg)
+				leg.Cancelled = !ok
+				t.Legs[i] = leg
+				changed = true
+
+				if leg.Cancelled {
+					mongo.Log("Triangle leg " + leg.Side + " " + leg.Pair + " on " + t.Exchange + " timed out, cancelled.")
+					continue
+				}
+
+			}
+
+			if leg.Filled {
+				continue
+			}
+
+			if leg.Tx_id == "" {
+				tx_id, placed := place_leg(t.Exchange, leg, true)
+				t.Legs[i].Tx_id = tx_id
+				t.Legs[i].Placed = time.Now()
+				changed = changed || placed
+			} else {
+				t.Legs[i].Filled = leg_filled(exchange, leg)
+			}
+
+			changed = changed || t.Legs[i].Filled
+			completed = completed && t.Legs[i].Filled
+
+		}
+
+		if changed {
+			mongo.Update_triangle_legs(t.ID.Hex(), t.Legs, completed)
+		}
+
+	}
+
+}
+
+// triangles already in flight, by exchange and token
+// so the same cycle isn't stacked run after run
+func open_triangles() map[string]bool {
+
+	open := make(map[string]bool)
+
+	for _, t := range mongo.Get_open_triangles() {
+		open[t.Exchange+t.Token] = true
+	}
+
+	return open
+
+}
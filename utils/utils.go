@@ -1,10 +1,17 @@
 package utils
 
 import (
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/crypto/sha3"
 	"gopkg.in/mgo.v2/bson"
 	"log"
 	"math"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,12 +25,57 @@ const (
 	BuyPlaced                       // 4
 	BuyCompleted                    // 5
 	BalancesReset                   // 6
+	Failed                          // 7
+	Cancelled                       // 8
 )
 
+// a change of status, as recorded in a transaction's history
+type Transition struct {
+	From      Status
+	To        Status
+	Reason    string
+	Timestamp time.Time
+}
+
+// legal transitions, keyed by the status they start from
+// statuses without any are terminal
+type State_machine map[Status][]Status
+
+// transfer strategy walks every status in order
+// inventory goes from SellCompleted straight to BuyPlaced
+// anything still moving can fail or be cancelled
+var Transaction_states = State_machine{
+	SellPlaced:        {SellCompleted, Failed, Cancelled},
+	SellCompleted:     {TransferStarted, BuyPlaced, Failed, Cancelled},
+	TransferStarted:   {TransferCompleted, Failed, Cancelled},
+	TransferCompleted: {BuyPlaced, Failed, Cancelled},
+	BuyPlaced:         {BuyCompleted, Failed, Cancelled},
+	BuyCompleted:      {BalancesReset, Failed, Cancelled},
+}
+
+func (m State_machine) Can_transition(from, to Status) bool {
+
+	for _, status := range m[from] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+func (m State_machine) Is_terminal(status Status) bool {
+
+	return len(m[status]) == 0
+
+}
+
 type Transaction struct {
 	ID            bson.ObjectId `bson:"_id,omitempty"`
 	Status        Status
 	Token         string
+	Quote         string
 	Sell_price    float64
 	Sell_cost     float64
 	Sell_quantity float64
@@ -34,19 +86,173 @@ type Transaction struct {
 	Buy_quantity  float64
 	Buy_exchange  string
 	Buy_tx_id     string
+	// withdrawal id given by the selling exchange, the chain txid
+	// it resolves to once sent, and the deposit it landed as
+	Transfer_id   string
+	Transfer_txid string
+	Deposit_id    string
+	// markets without the token on the quote go through another one
+	// ex: Sell_via "BTC" sells TOKEN-BTC and converts BTC to the quote
+	Sell_via        string
+	Sell_conversion Leg
+	Buy_via         string
+	Buy_conversion  Leg
+	Strategy        string
+	Paper           bool
+	History         []Transition
+	// set once the transaction is written to the ledger
+	Ledgered  bool
+	Timestamp time.Time
+}
+
+type Rebalance struct {
+	ID            bson.ObjectId `bson:"_id,omitempty"`
+	Asset         string
+	From_exchange string
+	To_exchange   string
+	Amount        float64
+	Fee           float64
+	Withdrawal_id string
+	Txid          string
+	Deposit_id    string
+	Landed        bool
+	Paper         bool
+	Landed_at     time.Time
+	Timestamp     time.Time
+}
+
+// realized profit withdrawn to the cold wallet
+type Sweep struct {
+	ID            bson.ObjectId `bson:"_id,omitempty"`
+	Exchange      string
+	Asset         string
+	Amount        float64
+	Fee           float64
+	Destination   string
+	Withdrawal_id string
+	Paper         bool
 	Timestamp     time.Time
 }
 
+// a cycle through three markets of one exchange
+// ex: ETH -> NULS -> BTC -> ETH, starting on "ETH" via "BTC"
+type Triangle struct {
+	ID             bson.ObjectId `bson:"_id,omitempty"`
+	Exchange       string
+	Start          string
+	Token          string
+	Via            string
+	Legs           []Leg
+	Profit_percent float64
+	Completed      bool
+	Paper          bool
+	Timestamp      time.Time
+}
+
+// placed is when the current order of the leg went in
+// cancelled legs timed out and were given up on
+type Leg struct {
+	Pair      string
+	Side      string
+	Quantity  float64
+	Price     float64
+	Tx_id     string
+	Placed    time.Time
+	Filled    bool
+	Cancelled bool
+}
+
+// an order as last reported by its exchange
+// partially filled orders are open with some quantity filled
+// quantity and price are what executed, fee is paid in the quote
+type Order_status struct {
+	Open     bool
+	Quantity float64
+	Price    float64
+	Fee      float64
+}
+
+// closed with something filled, in full or cancelled part way
+func (o Order_status) Done() bool {
+
+	return !o.Open && o.Quantity > 0
+
+}
+
+// quote value of what executed, before fees
+func (o Order_status) Cost() float64 {
+
+	return o.Quantity * o.Price
+
+}
+
 type Log struct {
 	Message   string
 	Timestamp time.Time
 }
 
-type Flag struct {
-	Message   string
+// one line of the profit and loss ledger, amounts are in ETH
+// positive when earned and negative when spent
+// kind is one of sell_proceeds, trading_fee, withdrawal_fee,
+// buy_cost or token_shortfall
+type Ledger_entry struct {
+	ID            bson.ObjectId `bson:"_id,omitempty"`
+	Trade         string
+	Token         string
+	Quote         string
+	Sell_exchange string
+	Buy_exchange  string
+	Kind          string
+	Amount        float64
+	Paper         bool
+	Timestamp     time.Time
+}
+
+// realized profit of trades grouped by trade, token, exchanges or day
+type Pnl struct {
+	Key    string  `bson:"_id"`
+	Profit float64 `bson:"profit"`
+	Trades int     `bson:"trades"`
+}
+
+// an order, withdrawal or new trade refused by the risk checks
+// limit is the one that refused, ie "MAX_SHARE", the same refusal
+// repeated run after run is counted on one row until it stops
+type Rejection struct {
+	ID        bson.ObjectId `bson:"_id,omitempty"`
+	Action    string
+	Limit     string
+	Exchange  string
+	Market    string
+	Amount    float64
+	Reason    string
+	Count     int
+	Paper     bool
+	Last_seen time.Time
 	Timestamp time.Time
 }
 
+// warnings are only recorded, halts stop new transactions
+// within their scope until the flag is cleared
+const (
+	Warning = "warning"
+	Halt    = "halt"
+)
+
+// scope is "global", "token" or "exchange"
+// with target naming the token or exchange
+// acknowledged flags have been seen, cleared ones no longer apply
+type Flag struct {
+	ID           bson.ObjectId `bson:"_id,omitempty"`
+	Severity     string
+	Scope        string
+	Target       string
+	Message      string
+	Acknowledged bool
+	Cleared      bool
+	Timestamp    time.Time
+}
+
 type Balance struct {
 	ID        bson.ObjectId `bson:"_id,omitempty"`
 	Token     string
@@ -55,13 +261,58 @@ type Balance struct {
 	Timestamp time.Time
 }
 
+// last price of a market along with its 24h volume, in the quote
+// and when it last traded, zero when the exchange doesn't say
+type Ticker struct {
+	Price     float64
+	Volume    float64
+	Timestamp time.Time
+}
+
+// a price left out of a comparison, and why
+type Rejected_price struct {
+	Exchange string
+	Price    float64
+	Reason   string
+}
+
 type Comparison struct {
+	Token        string
+	Quote        string
 	Min_price    float64
 	Max_price    float64
 	Min_exchange string
 	Max_exchange string
 	Difference   float64
-	Timestamp    time.Time
+	// executable side of the comparison, taken from order books
+	// we buy from asks on one exchange and sell into bids on another
+	Ask_exchange          string
+	Ask_price             float64
+	Ask_vwap              float64
+	Bid_exchange          string
+	Bid_price             float64
+	Bid_vwap              float64
+	Executable_difference float64
+	// quote a synthetic side goes through, empty for direct markets
+	Bid_via string
+	Ask_via string
+	// expected quote left over after all trading and withdrawal fees
+	Net_profit  float64
+	Net_percent float64
+	// prices that failed sanity checks before comparing
+	Rejected  []Rejected_price
+	Timestamp time.Time
+}
+
+type Order_level struct {
+	Price    float64
+	Quantity float64
+}
+
+// asks are sorted lowest first, bids highest first
+type Order_book struct {
+	Bids []Order_level
+	Asks []Order_level
 }
 
 type Discorder struct {
@@ -99,9 +350,16 @@ func main() {
 	}
 }
 
+// exchanges are fetched concurrently, and the log
+// file is opened and closed around every line
+var log_mutex sync.Mutex
+
 func Check(e error) {
 	if e != nil {
 
+		log_mutex.Lock()
+		defer log_mutex.Unlock()
+
 		f, err := os.OpenFile("log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
 			panic("couldn't open log file")
@@ -123,6 +381,102 @@ func ToFixed(num float64, precision int) float64 {
 	return float64(Round(num*output)) / output
 }
 
+// a credited deposit from an exchange's history, the id is
+// the exchange's own, or whatever identifies it when there's none
+// timestamp is zero when the exchange doesn't say when it landed
+type Deposit struct {
+	Id        string
+	Txid      string
+	Amount    float64
+	Timestamp time.Time
+}
+
+// amounts are matched when they're close enough to survive
+// each exchange's rounding, relative to the amount, 0.001 is 0.1%
+const Deposit_tolerance = 0.001
+
+// finds the deposit a transfer landed as and returns its id
+// only deposits from after the transfer started are candidates
+// and ones already matched to another transfer are skipped
+// with our txid known the deposit has to carry the same one
+// amounts are only matched while we don't know it, and only
+// on deposits that say when they landed
+func Match_deposit(deposits []Deposit, txid string, amount float64, since time.Time, matched map[string]bool) (string, bool) {
+
+	for _, d := range deposits {
+
+		if matched[d.Id] || (!d.Timestamp.IsZero() && d.Timestamp.Before(since)) {
+			continue
+		}
+
+		if txid != "" {
+
+			if d.Txid != "" && normalize_txid(txid) == normalize_txid(d.Txid) {
+				return d.Id, true
+			}
+
+			continue
+
+		}
+
+		if !d.Timestamp.IsZero() && math.Abs(d.Amount-amount) <= amount*Deposit_tolerance {
+			return d.Id, true
+		}
+
+	}
+
+	return "", false
+
+}
+
+// exchanges differ on case and the 0x prefix
+// and kucoin appends the address after an @
+func normalize_txid(txid string) string {
+
+	txid = strings.ToLower(strings.Split(txid, "@")[0])
+
+	return strings.TrimPrefix(txid, "0x")
+
+}
+
+// ETH and ERC20 addresses are 0x followed by 40 hex characters
+// with the case of each letter set by EIP-55, a keccak256 checksum
+// of the lowercase address, so that typos are caught before sending
+func Valid_eth_address(address string) bool {
+
+	if len(address) != 42 || !strings.HasPrefix(address, "0x") {
+		return false
+	}
+
+	plain := strings.ToLower(address[2:])
+
+	if _, err := hex.DecodeString(plain); err != nil {
+		return false
+	}
+
+	hasher := sha3.NewLegacyKeccak256()
+	hasher.Write([]byte(plain))
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	for i, c := range address[2:] {
+
+		if c >= '0' && c <= '9' {
+			continue
+		}
+
+		// letters are uppercase where the hash nibble is 8 or more
+		upper := hash[i] >= '8'
+
+		if upper != (c >= 'A' && c <= 'F') {
+			return false
+		}
+
+	}
+
+	return true
+
+}
+
 func Ternary(a, b int, condition bool) int {
 	if condition {
 		return a
@@ -160,6 +514,166 @@ func Merge_uniques(temp ...[]string) []string {
 
 }
 
+// pairs are kept in kucoin's format "LINK-ETH"
+// this returns the token part, ie "LINK"
+func Pair_token(pair string) string {
+	return strings.Split(pair, "-")[0]
+}
+
+// the quote part of a pair, ie "ETH"
+func Pair_quote(pair string) string {
+
+	split := strings.Split(pair, "-")
+
+	if len(split) < 2 {
+		return ""
+	}
+
+	return split[1]
+
+}
+
+func Pair(token, quote string) string {
+	return token + "-" + quote
+}
+
+// exchanges name markets their own way, ie "LINKETH" or "ETH_LINK"
+// this finds which quote the symbol trades against, if any
+// and returns the market in our own "LINK-ETH" format
+func Symbol_pair(symbol, separator string, quote_first bool, quotes map[string]bool) (string, bool) {
+
+	symbol = strings.ToUpper(symbol)
+
+	for quote := range quotes {
+
+		token := ""
+
+		if quote_first && strings.HasPrefix(symbol, quote+separator) {
+			token = strings.TrimPrefix(symbol, quote+separator)
+		}
+
+		if !quote_first && strings.HasSuffix(symbol, separator+quote) {
+			token = strings.TrimSuffix(symbol, separator+quote)
+		}
+
+		if token != "" {
+			return Pair(token, quote), true
+		}
+
+	}
+
+	return "", false
+
+}
+
+// the reverse of Symbol_pair, ie "LINK-ETH" to "LINKETH"
+func Pair_symbol(pair, separator string, quote_first bool) string {
+
+	if quote_first {
+		return Pair_quote(pair) + separator + Pair_token(pair)
+	}
+
+	return Pair_token(pair) + separator + Pair_quote(pair)
+
+}
+
+// most exchanges send order book levels as [price, quantity, ...]
+// with either numbers or strings, this reads both
+func Parse_levels(levels [][]interface{}) []Order_level {
+
+	var parsed []Order_level
+
+	for _, level := range levels {
+
+		if len(level) < 2 {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(fmt.Sprint(level[0]), 64)
+		Check(err)
+		quantity, err := strconv.ParseFloat(fmt.Sprint(level[1]), 64)
+		Check(err)
+
+		parsed = append(parsed, Order_level{Price: price, Quantity: quantity})
+
+	}
+
+	return parsed
+
+}
+
+// not every exchange sorts its book the same way
+func Sort_order_book(book Order_book) Order_book {
+
+	sort.Slice(book.Asks, func(i, j int) bool { return book.Asks[i].Price < book.Asks[j].Price })
+	sort.Slice(book.Bids, func(i, j int) bool { return book.Bids[i].Price > book.Bids[j].Price })
+
+	return book
+
+}
+
+// volume weighted price of filling quantity by walking the levels
+// false if the book isn't deep enough to fill all of it
+func Vwap(levels []Order_level, quantity float64) (float64, bool) {
+
+	filled := 0.0
+	cost := 0.0
+
+	if quantity <= 0 {
+		return 0, false
+	}
+
+	for _, level := range levels {
+
+		take := math.Min(level.Quantity, quantity-filled)
+		filled += take
+		cost += take * level.Price
+
+		if filled >= quantity {
+			return cost / filled, true
+		}
+
+	}
+
+	return 0, false
+
+}
+
+// middle of the values, average of the two middle ones when even
+func Median(values []float64) float64 {
+
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+
+}
+
+// last prices of tickers that have one
+func Ticker_prices(tickers map[string]Ticker) map[string]float64 {
+
+	prices := make(map[string]float64)
+
+	for pair, ticker := range tickers {
+		if ticker.Price > 0 {
+			prices[pair] = ticker.Price
+		}
+	}
+
+	return prices
+
+}
+
 func FileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
 		if os.IsNotExist(err) {
@@ -179,3 +693,190 @@ func CreateFile(name string) error {
 	}()
 	return nil
 }
+
+// how an exchange's api has been behaving since it was last checked
+// recorded by the exchange packages, main's circuit breakers judge it
+// consecutive errors carry over between checks until a call succeeds
+type Api_health struct {
+	Calls       int
+	Errors      int
+	Consecutive int
+	Slowest     time.Duration
+	Last_error  string
+}
+
+var api_health = make(map[string]*Api_health)
+var api_mutex sync.Mutex
+
+// records an api call, failed requests have no status
+// and any status from 400 up counts as an error
+func Api_call(exchange string, started time.Time, status int, err error) {
+
+	api_mutex.Lock()
+	defer api_mutex.Unlock()
+
+	health := get_api_health(exchange)
+	health.Calls++
+
+	// too many requests, binance bans with 418 when ignored
+	if status == 429 || status == 418 {
+		rate_limited(exchange)
+	}
+
+	if latency := time.Since(started); latency > health.Slowest {
+		health.Slowest = latency
+	}
+
+	if err != nil {
+		api_error(health, err.Error())
+	} else if status >= 400 {
+		api_error(health, "HTTP "+strconv.Itoa(status))
+	} else {
+		health.Consecutive = 0
+	}
+
+}
+
+// records a response that couldn't be parsed, returns whether it failed
+func Api_schema_error(exchange string, err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	Check(err)
+
+	api_mutex.Lock()
+	defer api_mutex.Unlock()
+
+	api_error(get_api_health(exchange), "bad response, "+err.Error())
+
+	return true
+
+}
+
+// health since the last check, starting a new period
+func Take_api_health(exchange string) Api_health {
+
+	api_mutex.Lock()
+	defer api_mutex.Unlock()
+
+	health := get_api_health(exchange)
+	taken := *health
+
+	api_health[exchange] = &Api_health{Consecutive: health.Consecutive}
+
+	return taken
+
+}
+
+func get_api_health(exchange string) *Api_health {
+
+	if api_health[exchange] == nil {
+		api_health[exchange] = &Api_health{}
+	}
+
+	return api_health[exchange]
+
+}
+
+func api_error(health *Api_health, message string) {
+
+	health.Errors++
+	health.Consecutive++
+	health.Last_error = message
+
+}
+
+// bounds on fetching from exchanges, set by main from .env
+// workers is how many calls to one exchange run at once
+var Workers = 4
+var Request_timeout = 20 * time.Second
+
+// when each exchange may be called next, spacing calls
+// out to its rate limit, or backing off after being told to
+var rate_limits = make(map[string]time.Duration)
+var next_call = make(map[string]time.Time)
+var rate_mutex sync.Mutex
+
+// how long to leave an exchange alone after a 429 or 418
+var Rate_backoff = 30 * time.Second
+
+// calls per second an exchange allows, 0 for no limit
+func Rate_limit(exchange string, per_second float64) {
+
+	rate_mutex.Lock()
+	defer rate_mutex.Unlock()
+
+	if per_second > 0 {
+		rate_limits[exchange] = time.Duration(float64(time.Second) / per_second)
+	}
+
+}
+
+// blocks until it's the exchange's turn to be called
+func Wait_turn(exchange string) {
+
+	rate_mutex.Lock()
+
+	now := time.Now()
+	turn := next_call[exchange]
+
+	if turn.Before(now) {
+		turn = now
+	}
+
+	next_call[exchange] = turn.Add(rate_limits[exchange])
+
+	rate_mutex.Unlock()
+
+	time.Sleep(time.Until(turn))
+
+}
+
+func rate_limited(exchange string) {
+
+	rate_mutex.Lock()
+	defer rate_mutex.Unlock()
+
+	if until := time.Now().Add(Rate_backoff); next_call[exchange].Before(until) {
+		next_call[exchange] = until
+	}
+
+}
+
+// runs do for every item, at most Workers at a time
+// and at least one, or nothing would ever take from the queue
+func Parallel(items []string, do func(item string)) {
+
+	var wait sync.WaitGroup
+
+	queue := make(chan string)
+	workers := Workers
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers && i < len(items); i++ {
+
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for item := range queue {
+				do(item)
+			}
+		}()
+
+	}
+
+	for _, item := range items {
+		queue <- item
+	}
+
+	close(queue)
+	wait.Wait()
+
+}